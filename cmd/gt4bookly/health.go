@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Dorrrke/gt4-bookly/internal/health"
+	"github.com/Dorrrke/gt4-bookly/internal/leader"
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/Dorrrke/gt4-bookly/internal/scheduler"
+	"github.com/Dorrrke/gt4-bookly/internal/storage"
+)
+
+type storageProbe interface {
+	Ping(context.Context) error
+	MigrationVersion(context.Context) (uint, bool, error)
+}
+
+// watchedStorage is a probe whose connection is kept by a background watch.
+// It turns healthy only once it has connected and migrated.
+type watchedStorage interface {
+	Healthy() bool
+	Err() error
+}
+
+var errStorageStarting = errors.New("storage is not connected and migrated yet")
+
+// registerChecks wires readiness checks. probe is nil for the memory backend,
+// which has nothing to ping or migrate.
+func registerChecks(
+	checker *health.Checker,
+	backend string,
+	probe storageProbe,
+	migratePath string,
+	sched *scheduler.Scheduler,
+	elector *leader.Elector,
+) {
+	log := logger.Get()
+	checker.Register("storage", func(ctx context.Context) health.Component {
+		details := map[string]any{"backend": backend}
+		if probe == nil {
+			return health.Up(details)
+		}
+		if watched, ok := probe.(watchedStorage); ok && !watched.Healthy() {
+			err := watched.Err()
+			if err == nil {
+				err = errStorageStarting
+			}
+			return health.Down(err, details)
+		}
+		if err := probe.Ping(ctx); err != nil {
+			return health.Down(err, details)
+		}
+		return health.Up(details)
+	})
+	if probe != nil {
+		latest, err := storage.LatestMigration(migratePath)
+		if err != nil {
+			log.Warn().Err(err).Msg("read migrations failed, readiness will not compare versions")
+		}
+		checker.Register("migrations", func(ctx context.Context) health.Component {
+			version, dirty, err := probe.MigrationVersion(ctx)
+			details := map[string]any{"version": version, "dirty": dirty, "latest": latest}
+			switch {
+			case err != nil:
+				return health.Down(err, details)
+			case dirty:
+				return health.Down(fmt.Errorf("migration %d is dirty", version), details)
+			case latest != 0 && version != latest:
+				return health.Down(fmt.Errorf("schema version %d, want %d", version, latest), details)
+			}
+			return health.Up(details)
+		})
+	}
+	checker.Register("scheduler", func(context.Context) health.Component {
+		details := map[string]any{"running": sched.Running(), "leader": elector.IsLeader()}
+		// Only the leader runs background jobs, followers are ready without them.
+		if elector.IsLeader() && !sched.Running() {
+			return health.Down(nil, details)
+		}
+		return health.Up(details)
+	})
+}
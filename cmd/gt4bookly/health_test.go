@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/health"
+	"github.com/Dorrrke/gt4-bookly/internal/leader"
+	"github.com/Dorrrke/gt4-bookly/internal/scheduler"
+	"github.com/Dorrrke/gt4-bookly/internal/storage"
+)
+
+// fakeDB answers pings like a database that is reachable, whether or not
+// Watch has connected and migrated it yet.
+type fakeDB struct {
+	healthy bool
+	err     error
+}
+
+func (*fakeDB) Ping(context.Context) error { return nil }
+
+func (*fakeDB) MigrationVersion(context.Context) (uint, bool, error) { return 0, false, nil }
+
+func (f *fakeDB) Healthy() bool { return f.healthy }
+
+func (f *fakeDB) Err() error { return f.err }
+
+func TestStorageReadyAfterWatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		db      *fakeDB
+		status  health.Status
+		wantErr string
+	}{
+		{name: "starting", db: &fakeDB{}, status: health.StatusDown, wantErr: errStorageStarting.Error()},
+		{name: "unreachable", db: &fakeDB{err: errors.New("dial tcp: refused")}, status: health.StatusDown,
+			wantErr: "dial tcp: refused"},
+		{name: "connected and migrated", db: &fakeDB{healthy: true}, status: health.StatusUp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := health.New(time.Second)
+			sched := scheduler.New(storage.NewJobStor())
+			registerChecks(checker, "postgres", tt.db, "../../migrations", sched, leader.New(nil, "jobs", time.Second))
+			comp := checker.Check(context.Background()).Components["storage"]
+			if comp.Status != tt.status || comp.Error != tt.wantErr {
+				t.Fatalf("storage %+v, want %s %q", comp, tt.status, tt.wantErr)
+			}
+		})
+	}
+}
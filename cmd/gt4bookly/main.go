@@ -2,24 +2,51 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	stdlog "log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/Dorrrke/gt4-bookly/internal/config"
+	"github.com/Dorrrke/gt4-bookly/internal/events"
+	"github.com/Dorrrke/gt4-bookly/internal/health"
+	"github.com/Dorrrke/gt4-bookly/internal/leader"
 	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/Dorrrke/gt4-bookly/internal/metrics"
+	"github.com/Dorrrke/gt4-bookly/internal/ratelimit"
+	"github.com/Dorrrke/gt4-bookly/internal/scheduler"
 	"github.com/Dorrrke/gt4-bookly/internal/server"
 	"github.com/Dorrrke/gt4-bookly/internal/service"
-	"github.com/Dorrrke/gt4-bookly/internal/storage"
+	"github.com/Dorrrke/gt4-bookly/internal/tracing"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"golang.org/x/sync/errgroup"
 )
 
 func main() {
-	cfg := config.ReadConfig()
-	log := logger.Get(cfg.Debug)
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(configCommand(os.Args[2:]))
+	}
+	cfg, err := config.ReadConfig()
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		stdlog.Fatalf("invalid config:\n%v", err)
+	}
+	if err = initLogger(cfg); err != nil {
+		stdlog.Fatal(err)
+	}
+	log := logger.Get()
 	log.Debug().Any("cfg", cfg).Msg("config")
+	if cfg.JWTSecret == config.DefaultJWTSecret {
+		log.Warn().Msg("auth.jwt_secret is the built-in default, set JWT_SECRET")
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
@@ -31,50 +58,174 @@ func main() {
 		cancel()
 	}()
 
-	var userService service.UserService
-	var bookService service.BookService
-
-	err := storage.Migrations(cfg.DbDSN, cfg.MigratePath)
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter:    cfg.TraceExporter,
+		Endpoint:    cfg.TraceEndpoint,
+		File:        cfg.TraceFile,
+		SampleRatio: cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("tracing setup failed")
+	}
+	stor, err := buildStorage(ctx, cfg)
 	if err != nil {
 		log.Fatal().Err(err).Send()
 	}
-	stor, err := storage.NewDB(context.Background(), cfg.DbDSN)
+	a, err := newApp(cfg, stor)
 	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+
+	if err = a.run(ctx, cfg); err != nil {
 		log.Error().Err(err).Send()
-		bStor := storage.NewBookStor()
-		uStor := storage.NewUserStor()
-		userService = service.NewUserService(uStor)
-		bookService = service.NewBookService(bStor)
-	} else {
-		userService = service.NewUserService(stor)
-		bookService = service.NewBookService(stor)
-	}
-	serve := server.New(cfg, userService, bookService)
+	}
+	// Storage is closed only after the server has drained its requests.
+	if err = stor.close(); err != nil {
+		log.Error().Err(err).Msg("close storage failed")
+	}
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer flushCancel()
+	if err = shutdownTracing(flushCtx); err != nil {
+		log.Error().Err(err).Msg("flush traces failed")
+	}
+	log.Info().Msg("server stoped")
+	if err = logger.Close(); err != nil {
+		stdlog.Println(err)
+	}
+}
+
+func initLogger(cfg config.Config) error {
+	return logger.Init(logger.Config{
+		Level:        cfg.LogLevel,
+		Format:       cfg.LogFormat,
+		File:         cfg.LogFile,
+		MaxSizeMB:    cfg.LogMaxSizeMB,
+		MaxBackups:   cfg.LogMaxBackups,
+		MaxAgeDays:   cfg.LogMaxAgeDays,
+		RotateEvery:  cfg.LogRotateEvery,
+		DebugBurst:   uint32(max(cfg.LogDebugBurst, 0)),
+		RedactFields: cfg.LogRedact,
+	})
+}
+
+// app is everything main runs until shutdown.
+type app struct {
+	serve    *server.BooklyAPI
+	webhooks service.WebhookService
+	relay    *events.Relay
+	sched    *scheduler.Scheduler
+	elector  *leader.Elector
+	reload   *reloader
+	watch    func(context.Context) error
+}
+
+func newApp(cfg config.Config, stor *backend) (*app, error) {
+	webhookService := service.NewWebhookService(stor.webhooks)
+	auditService := service.NewAuditService(stor.audit)
+	lockout := ratelimit.NewLockout(stor.limits, ratelimit.LockoutPolicy{
+		Threshold: cfg.LockoutAttempts,
+		Base:      cfg.LockoutBase,
+		Max:       cfg.LockoutMax,
+		Window:    cfg.LockoutWindow,
+	})
+	userService := service.NewUserService(stor.users, &auditService, lockout)
+	bookService := service.NewBookService(stor.books, &auditService)
 
+	bus := events.NewBus()
+	bus.Subscribe("webhooks", webhookService.HandleEvent, events.Public...)
+	bus.Subscribe("audit", auditService.HandleEvent, events.AuditRecorded)
+	sched := scheduler.New(stor.jobs)
+	if err := registerJobs(sched, cfg, bookService, stor); err != nil {
+		return nil, err
+	}
+	metrics.RegisterQueue("webhooks", webhookService.QueueDepth)
+	elector := leader.New(stor.leases, "background-jobs", cfg.LeaseTTL)
+	checker := health.New(2 * time.Second)
+	registerChecks(checker, cfg.Storage, stor.probe, stor.migratePath, sched, elector)
+	serve, err := server.New(cfg, userService, bookService, webhookService, auditService, sched, checker, stor.limits)
+	if err != nil {
+		return nil, fmt.Errorf("server init failed: %w", err)
+	}
+	return &app{
+		serve:    serve,
+		webhooks: webhookService,
+		relay:    events.NewRelay(stor.outbox, bus, time.Second),
+		sched:    sched,
+		elector:  elector,
+		reload:   &reloader{args: os.Args[1:], cur: cfg, serve: serve, sched: sched},
+		watch:    stor.watch,
+	}, nil
+}
+
+func registerJobs(sched *scheduler.Scheduler, cfg config.Config, bookService service.BookService, stor *backend) error {
+	purgeSchedule, err := scheduler.ParseSchedule(cfg.PurgeSchedule)
+	if err != nil {
+		return err
+	}
+	sweepSchedule, err := scheduler.ParseSchedule(cfg.RateLimitSweep)
+	if err != nil {
+		return err
+	}
+	outboxSchedule, err := scheduler.ParseSchedule(cfg.OutboxSweep)
+	if err != nil {
+		return err
+	}
+	sched.Register(scheduler.Job{
+		Name:     service.PurgeJobName,
+		Schedule: purgeSchedule,
+		Retries:  cfg.PurgeRetries,
+		Backoff:  cfg.PurgeBackoff,
+		Run: func(ctx context.Context) (int, error) {
+			return bookService.PurgeDeleted(ctx, cfg.Retention)
+		},
+	})
+	metrics.RegisterQueue(service.PurgeJobName, func() int { return sched.Pending(service.PurgeJobName) })
+	sched.Register(scheduler.Job{
+		Name:     ratelimit.CleanupJobName,
+		Schedule: sweepSchedule,
+		Run: func(ctx context.Context) (int, error) {
+			return stor.limits.DeleteExpired(ctx, cfg.LockoutWindow)
+		},
+	})
+	sched.Register(scheduler.Job{
+		Name:     events.CleanupJobName,
+		Schedule: outboxSchedule,
+		Run: func(ctx context.Context) (int, error) {
+			return stor.outbox.DeleteDispatched(ctx, cfg.OutboxRetention)
+		},
+	})
+	return nil
+}
+
+// run serves until ctx is done and the server has drained. Background jobs
+// run only while this replica holds the lease.
+func (a *app) run(ctx context.Context, cfg config.Config) error {
 	group, gCtx := errgroup.WithContext(ctx)
 	group.Go(func() error {
-		if err := serve.Run(gCtx); err != nil {
-			log.Error().Err(err).Send()
-			return err
-		}
-		return nil
+		return a.serve.Run(gCtx)
 	})
 	group.Go(func() error {
-		log.Debug().Msg("start listening error channel")
-		defer log.Debug().Msg("stop listening error channel")
-		return <-serve.ErrChan
+		return a.watch(gCtx)
 	})
 	group.Go(func() error {
-		<-gCtx.Done()
-		return serve.Shutdown(gCtx)
+		return a.reload.Run(gCtx)
+	})
+	group.Go(func() error {
+		return a.webhooks.Run(gCtx)
+	})
+	group.Go(func() error {
+		return a.elector.Run(gCtx, func(ctx context.Context) error {
+			jobs, jCtx := errgroup.WithContext(ctx)
+			jobs.Go(func() error { return a.relay.Run(jCtx) })
+			jobs.Go(func() error { return a.sched.Run(jCtx) })
+			return jobs.Wait()
+		})
 	})
 	group.Go(func() error {
 		<-gCtx.Done()
-		return stor.Close()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.DrainPeriod+cfg.ShutdownTimeout)
+		defer shutdownCancel()
+		return a.serve.Shutdown(shutdownCtx)
 	})
-
-	if err := group.Wait(); err != nil {
-		log.Error().Err(err).Send()
-	}
-	log.Info().Msg("server stoped")
+	return group.Wait()
 }
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.Init(logger.Config{Level: "disabled", Format: logger.FormatJSON}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
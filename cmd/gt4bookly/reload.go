@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/config"
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/Dorrrke/gt4-bookly/internal/scheduler"
+	"github.com/Dorrrke/gt4-bookly/internal/server"
+	"github.com/Dorrrke/gt4-bookly/internal/service"
+)
+
+const configPollInterval = 2 * time.Second
+
+// reloader re-reads the config on SIGHUP or when the config file changes and
+// applies the settings tagged reload. A config that fails to load or validate
+// is rejected as a whole and the running one is kept.
+type reloader struct {
+	args  []string
+	cur   config.Config
+	serve *server.BooklyAPI
+	sched *scheduler.Scheduler
+}
+
+func (r *reloader) Run(ctx context.Context) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+	modTime := fileModTime(r.cur.File)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			modTime = fileModTime(r.cur.File)
+			r.reload("sighup")
+		case <-ticker.C:
+			if mt := fileModTime(r.cur.File); !mt.Equal(modTime) {
+				modTime = mt
+				r.reload("file")
+			}
+		}
+	}
+}
+
+func (r *reloader) reload(trigger string) {
+	log := logger.Get().With().Str("trigger", trigger).Logger()
+	next, _, err := config.Load(r.args)
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("config reload rejected")
+		return
+	}
+	// Everything that can fail is done before the first setting is applied.
+	schedule, err := scheduler.ParseSchedule(next.PurgeSchedule)
+	if err != nil {
+		log.Error().Err(err).Msg("config reload rejected")
+		return
+	}
+	changes := r.cur.Diff(next)
+	if len(changes) == 0 {
+		log.Info().Msg("config unchanged")
+		return
+	}
+	applied := r.cur.Reloaded(next)
+
+	// Only touch what changed, so a level set through the admin API or the
+	// purge timer survive unrelated reloads.
+	if applied.LogLevel != r.cur.LogLevel {
+		if err := logger.SetLevel(applied.LogLevel); err != nil {
+			log.Error().Err(err).Msg("set log level failed")
+		}
+	}
+	r.serve.Reload(applied)
+	if applied.PurgeSchedule != r.cur.PurgeSchedule {
+		if err := r.sched.Reschedule(service.PurgeJobName, schedule); err != nil {
+			log.Error().Err(err).Msg("reschedule purge failed")
+		}
+	}
+	r.cur = applied
+
+	for _, c := range changes {
+		evt := log.Info()
+		msg := "config setting reloaded"
+		if !c.Reload {
+			evt = log.Warn()
+			msg = "config setting needs restart, ignored"
+		}
+		evt.Str("key", c.Key).Str("old", c.Old).Str("new", c.New).Msg(msg)
+	}
+}
+
+func fileModTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
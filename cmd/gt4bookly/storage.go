@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/Dorrrke/gt4-bookly/internal/config"
+	"github.com/Dorrrke/gt4-bookly/internal/events"
+	"github.com/Dorrrke/gt4-bookly/internal/leader"
+	"github.com/Dorrrke/gt4-bookly/internal/metrics"
+	"github.com/Dorrrke/gt4-bookly/internal/ratelimit"
+	"github.com/Dorrrke/gt4-bookly/internal/scheduler"
+	"github.com/Dorrrke/gt4-bookly/internal/service"
+	"github.com/Dorrrke/gt4-bookly/internal/storage"
+)
+
+// backend holds the stores of the configured storage backend and how to
+// watch, probe and close it.
+type backend struct {
+	users    service.Storage
+	books    service.BookStorage
+	webhooks service.WebhookStorage
+	audit    service.AuditStorage
+	outbox   events.Outbox
+	jobs     scheduler.StateStorage
+	// leases is nil when a single process owns the storage.
+	leases leader.LeaseStorage
+	limits ratelimit.Storage
+	// probe is nil for the memory backend, which has nothing to ping or migrate.
+	probe       storageProbe
+	migratePath string
+	watch       func(context.Context) error
+	close       func() error
+}
+
+func buildStorage(ctx context.Context, cfg config.Config) (*backend, error) {
+	switch cfg.Storage {
+	case config.StoragePostgres:
+		return buildPostgres(ctx, cfg)
+	case config.StorageSQLite:
+		return buildSQLite(ctx, cfg)
+	case config.StorageMemory:
+		return buildMemory(), nil
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage)
+}
+
+func buildPostgres(ctx context.Context, cfg config.Config) (*backend, error) {
+	poolCfg := storage.PoolConfig{
+		MaxConns:          cfg.DBMaxConns,
+		MinConns:          cfg.DBMinConns,
+		HealthCheckPeriod: cfg.DBHealthCheck,
+		StatementCache:    cfg.DBStatementCache,
+	}
+	migrate := func(context.Context) error { return storage.Migrations(cfg.DbDSN.Value(), cfg.MigratePath) }
+	var stor *storage.DBStorage
+	var err error
+	if cfg.DBFailFast {
+		stor, err = storage.NewDB(ctx, cfg.DbDSN.Value(), poolCfg)
+		if err == nil {
+			err = migrate(ctx)
+		}
+		migrate = nil
+	} else {
+		// Start degraded and let Watch connect and migrate in the background.
+		stor, err = storage.OpenDB(cfg.DbDSN.Value(), poolCfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("postgres storage init failed: %w", err)
+	}
+	metrics.RegisterPool(stor.Stat)
+	var limits ratelimit.Storage = storage.NewLimitStor()
+	if cfg.RateLimitStore == config.RateLimitPostgres {
+		limits = stor
+	}
+	return &backend{
+		users:       stor,
+		books:       stor,
+		webhooks:    stor,
+		audit:       stor,
+		outbox:      stor,
+		jobs:        stor,
+		leases:      stor,
+		limits:      limits,
+		probe:       stor,
+		migratePath: cfg.MigratePath,
+		watch:       func(ctx context.Context) error { return stor.Watch(ctx, migrate) },
+		close:       stor.Close,
+	}, nil
+}
+
+// buildSQLite keeps everything but the rate limits in the file. A single
+// process owns the file, so no lease is needed.
+func buildSQLite(ctx context.Context, cfg config.Config) (*backend, error) {
+	migratePath := filepath.Join(cfg.MigratePath, "sqlite")
+	if err := storage.Migrations(storage.SQLiteDSN(cfg.SQLitePath), migratePath); err != nil {
+		return nil, err
+	}
+	stor, err := storage.NewSQLite(ctx, cfg.SQLitePath)
+	if err != nil {
+		return nil, err
+	}
+	return &backend{
+		users:       stor,
+		books:       stor,
+		webhooks:    stor,
+		audit:       stor,
+		outbox:      stor,
+		jobs:        stor,
+		limits:      storage.NewLimitStor(),
+		probe:       stor,
+		migratePath: migratePath,
+		watch:       func(context.Context) error { return nil },
+		close:       stor.Close,
+	}, nil
+}
+
+func buildMemory() *backend {
+	outbox := storage.NewOutbox()
+	return &backend{
+		users:    storage.NewUserStor(outbox),
+		books:    storage.NewBookStor(outbox),
+		webhooks: storage.NewWebhookStor(),
+		audit:    storage.NewAuditStor(),
+		outbox:   outbox,
+		jobs:     storage.NewJobStor(),
+		limits:   storage.NewLimitStor(),
+		watch:    func(context.Context) error { return nil },
+		close:    func() error { return nil },
+	}
+}
@@ -0,0 +1,319 @@
+package config
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Sources maps a setting key to where its effective value came from,
+// e.g. "env SRV_PORT" or "file bookly.yaml".
+type Sources map[string]string
+
+type flagSpec struct {
+	key   string
+	name  string
+	usage string
+}
+
+var flags = []flagSpec{
+	{"config", "config", "yaml or toml config file"},
+	{"server.host", "host", "server host address"},
+	{"server.port", "port", "server port"},
+	{"server.shutdown_timeout", "shutdown-timeout", "time to finish in-flight requests on stop"},
+	{"server.drain_period", "drain-period", "time readiness fails before the listener closes on stop"},
+	{"server.tls_cert", "tls-cert", "tls certificate file, enables https"},
+	{"server.tls_key", "tls-key", "tls private key file"},
+	{"debug", "debug", "enable logger debug level"},
+	{"storage.backend", "storage", "storage backend: postgres, sqlite or memory"},
+	{"storage.sqlite_path", "sqlite-path", "sqlite database file"},
+	{"db.fail_fast", "db-fail-fast", "exit on start if postgres is unreachable"},
+	{"db.max_conns", "db-max-conns", "max connections in postgres pool"},
+	{"db.min_conns", "db-min-conns", "min idle connections in postgres pool"},
+	{"purge.retention", "retention", "how long deleted books stay in trash before purge"},
+	{"purge.schedule", "purge-schedule", "purge interval or cron expression"},
+	{"leader.lease_ttl", "lease-ttl", "leader lease ttl for background jobs"},
+	{"log.level", "log-level", "log level, info by default or debug with -debug"},
+	{"log.format", "log-format", "log format: json or console, console with -debug"},
+	{"log.file", "log-file", "write logs to a rotated file instead of stdout"},
+	{"trace.exporter", "trace-exporter", "trace exporter: none, otlp or stdout"},
+	{"trace.sample_ratio", "trace-sample-ratio", "share of new traces to sample"},
+}
+
+// ReadConfig loads the config from os.Args and validates it.
+func ReadConfig() (Config, error) {
+	cfg, _, err := Load(os.Args[1:])
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// Load layers defaults, the config file given by -config or CONFIG_FILE,
+// env variables and flags, later layers winning. The result is not validated.
+func Load(args []string) (Config, Sources, error) {
+	cfg := Default()
+	fields := schema(&cfg)
+	src := make(Sources, len(fields))
+	for key := range fields {
+		src[key] = SourceDefault
+	}
+
+	fs := flag.NewFlagSet("bookly", flag.ContinueOnError)
+	set := make(map[string]string)
+	for _, f := range flags {
+		isBool := fields[f.key].value.Kind() == reflect.Bool
+		fs.Var(&flagValue{key: f.key, set: set, bool: isBool}, f.name, f.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, src, err
+	}
+
+	// The file path itself can only come from env or flags.
+	path := cmp.Or(set["config"], os.Getenv("CONFIG_FILE"))
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return cfg, src, err
+		}
+		for key, val := range values {
+			field, ok := fields[key]
+			if !ok || key == "config" {
+				return cfg, src, fmt.Errorf("%s: unknown setting %q", path, key)
+			}
+			if err := setAny(field.value, val); err != nil {
+				return cfg, src, fmt.Errorf("%s: %s: %w", path, key, err)
+			}
+			src[key] = SourceFile + " " + path
+		}
+	}
+
+	for key, field := range fields {
+		if val := os.Getenv(field.env); val != "" {
+			if err := setString(field.value, val); err != nil {
+				return cfg, src, fmt.Errorf("%s: %w", field.env, err)
+			}
+			src[key] = SourceEnv + " " + field.env
+		}
+	}
+
+	for _, f := range flags {
+		val, ok := set[f.key]
+		if !ok {
+			continue
+		}
+		if err := setString(fields[f.key].value, val); err != nil {
+			return cfg, src, fmt.Errorf("-%s: %w", f.name, err)
+		}
+		src[f.key] = SourceFlag + " -" + f.name
+	}
+
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = "info"
+		if cfg.Debug {
+			cfg.LogLevel = "debug"
+		}
+	}
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = "json"
+		if cfg.Debug {
+			cfg.LogFormat = "console"
+		}
+	}
+	return cfg, src, nil
+}
+
+// Keys returns the setting keys in schema order.
+func Keys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := make([]string, 0, t.NumField())
+	for i := range t.NumField() {
+		keys = append(keys, t.Field(i).Tag.Get("key"))
+	}
+	return keys
+}
+
+// Get returns the value of key formatted the way Load accepts it, secrets
+// are redacted.
+func (c Config) Get(key string) string {
+	field, ok := schema(&c)[key]
+	if !ok {
+		return ""
+	}
+	return format(field.value)
+}
+
+func format(v reflect.Value) string {
+	if v.Kind() == reflect.Slice {
+		items := make([]string, v.Len())
+		for i := range v.Len() {
+			items[i] = format(v.Index(i))
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+type setting struct {
+	value reflect.Value
+	env   string
+}
+
+// schema indexes the settable fields of cfg by key.
+func schema(cfg *Config) map[string]setting {
+	v := reflect.ValueOf(cfg).Elem()
+	fields := make(map[string]setting, v.NumField())
+	for i := range v.NumField() {
+		tag := v.Type().Field(i).Tag
+		fields[tag.Get("key")] = setting{value: v.Field(i), env: tag.Get("env")}
+	}
+	return fields
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setString(field reflect.Value, val string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(val)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case field.Kind() == reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		setList(field, list)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// setAny sets a value decoded from a config file. Lists are taken as is,
+// scalars go through the same parsing as env values.
+func setAny(field reflect.Value, val any) error {
+	list, ok := val.([]any)
+	if !ok {
+		return setString(field, fmt.Sprint(val))
+	}
+	if field.Kind() != reflect.Slice {
+		return errors.New("unexpected list")
+	}
+	items := make([]string, 0, len(list))
+	for _, item := range list {
+		items = append(items, fmt.Sprint(item))
+	}
+	setList(field, items)
+	return nil
+}
+
+// setList fills a slice of any string type, e.g. []Secret.
+func setList(field reflect.Value, items []string) {
+	list := reflect.MakeSlice(field.Type(), 0, len(items))
+	for _, item := range items {
+		list = reflect.Append(list, reflect.ValueOf(item).Convert(field.Type().Elem()))
+	}
+	field.Set(list)
+}
+
+func readFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]any
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config format %q", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	values := make(map[string]any)
+	flatten("", tree, values)
+	return values, nil
+}
+
+func flatten(prefix string, tree map[string]any, out map[string]any) {
+	for k, v := range tree {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if sub, ok := v.(map[string]any); ok {
+			flatten(key, sub, out)
+			continue
+		}
+		out[key] = v
+	}
+}
+
+// flagValue keeps the raw flag value so flags are applied after the file
+// and env layers.
+type flagValue struct {
+	key  string
+	set  map[string]string
+	bool bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil || f.set == nil {
+		return ""
+	}
+	return f.set[f.key]
+}
+
+func (f *flagValue) Set(val string) error {
+	f.set[f.key] = val
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.bool
+}
@@ -0,0 +1,125 @@
+package config_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/config"
+)
+
+func writeConfig(t *testing.T, name, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := writeConfig(t, "bookly.yaml", "server:\n  port: 9001\npurge:\n  retention: 48h\n")
+	tomlFile := writeConfig(t, "bookly.toml", "[server]\nport = 9001\n\n[purge]\nretention = \"48h\"\n")
+	tests := []struct {
+		name    string
+		file    string
+		env     string
+		args    []string
+		port    int
+		portSrc string
+		// retention only ever comes from the file, so it shows the file
+		// was read even when a later layer wins the port.
+		retention time.Duration
+	}{
+		{name: "defaults", port: 8081, portSrc: config.SourceDefault, retention: config.Default().Retention},
+		{name: "yaml file", file: yamlFile, port: 9001, portSrc: "file " + yamlFile, retention: 48 * time.Hour},
+		{name: "toml file", file: tomlFile, port: 9001, portSrc: "file " + tomlFile, retention: 48 * time.Hour},
+		{name: "env over file", file: yamlFile, env: "9002", port: 9002, portSrc: "env SRV_PORT",
+			retention: 48 * time.Hour},
+		{name: "flag over env", file: tomlFile, env: "9002", args: []string{"-port", "9003"}, port: 9003,
+			portSrc: "flag -port", retention: 48 * time.Hour},
+		{name: "config flag", args: []string{"-config", yamlFile}, port: 9001, portSrc: "file " + yamlFile,
+			retention: 48 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", tt.file)
+			t.Setenv("SRV_PORT", tt.env)
+			cfg, src, err := config.Load(tt.args)
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if cfg.Port != tt.port || src["server.port"] != tt.portSrc {
+				t.Fatalf("port %d from %q, want %d from %q", cfg.Port, src["server.port"], tt.port, tt.portSrc)
+			}
+			if cfg.Retention != tt.retention {
+				t.Fatalf("retention %s, want %s", cfg.Retention, tt.retention)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		key  string
+	}{
+		{name: "bookly.yaml", body: "server:\n  prot: 9001\n", key: "server.prot"},
+		{name: "bookly.toml", body: "[server]\nprot = 9001\n", key: "server.prot"},
+		{name: "top.yaml", body: "verbose: true\n", key: "verbose"},
+		// The file cannot point at another file.
+		{name: "nested.yaml", body: "config: other.yaml\n", key: "config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", writeConfig(t, tt.name, tt.body))
+			_, _, err := config.Load(nil)
+			if err == nil || !strings.Contains(err.Error(), `unknown setting "`+tt.key+`"`) {
+				t.Fatalf("load: %v, want unknown setting %q", err, tt.key)
+			}
+		})
+	}
+}
+
+func TestSecretsRedacted(t *testing.T) {
+	const dsn = "postgres://bookly:hunter22@db:5432/bookly"
+	t.Setenv("CONFIG_FILE", writeConfig(t, "bookly.yaml",
+		"db:\n  dsn: "+dsn+"\nauth:\n  jwt_verify_secrets: [old-key-1, old-key-2]\n"))
+	t.Setenv("JWT_SECRET", "new-signing-key")
+	cfg, _, err := config.Load(nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.DbDSN.Value() != dsn || cfg.JWTSecret.Value() != "new-signing-key" {
+		t.Fatalf("secret values %q and %q were not loaded", cfg.DbDSN.Value(), cfg.JWTSecret.Value())
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "db.dsn", want: "[REDACTED]"},
+		{key: "auth.jwt_secret", want: "[REDACTED]"},
+		{key: "auth.jwt_verify_secrets", want: "[REDACTED],[REDACTED]"},
+		{key: "server.port", want: "8081"},
+	}
+	for _, tt := range tests {
+		if got := cfg.Get(tt.key); got != tt.want {
+			t.Errorf("Get(%s) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	for _, secret := range []string{"hunter22", "new-signing-key", "old-key-1", "old-key-2"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("%s leaks through MarshalJSON: %s", secret, data)
+		}
+	}
+}
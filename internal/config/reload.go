@@ -0,0 +1,46 @@
+package config
+
+import (
+	"reflect"
+)
+
+// Change is one setting that differs between two configs. Values are
+// formatted with secrets redacted.
+type Change struct {
+	Key    string `json:"key"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+	Reload bool   `json:"reload"`
+}
+
+// Diff lists the settings that differ from c in next, in schema order.
+func (c Config) Diff(next Config) []Change {
+	oldV, newV := reflect.ValueOf(c), reflect.ValueOf(next)
+	var changes []Change
+	for i := range oldV.NumField() {
+		if reflect.DeepEqual(oldV.Field(i).Interface(), newV.Field(i).Interface()) {
+			continue
+		}
+		tag := oldV.Type().Field(i).Tag
+		changes = append(changes, Change{
+			Key:    tag.Get("key"),
+			Old:    format(oldV.Field(i)),
+			New:    format(newV.Field(i)),
+			Reload: tag.Get("reload") == "true",
+		})
+	}
+	return changes
+}
+
+// Reloaded returns c with the runtime changeable settings taken from next.
+// Everything else keeps its current value until restart.
+func (c Config) Reloaded(next Config) Config {
+	cur := reflect.ValueOf(&c).Elem()
+	src := reflect.ValueOf(next)
+	for i := range cur.NumField() {
+		if cur.Type().Field(i).Tag.Get("reload") == "true" {
+			cur.Field(i).Set(src.Field(i))
+		}
+	}
+	return c
+}
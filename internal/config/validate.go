@@ -0,0 +1,126 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/Dorrrke/gt4-bookly/internal/ratelimit"
+	"github.com/Dorrrke/gt4-bookly/internal/scheduler"
+	"github.com/Dorrrke/gt4-bookly/internal/tracing"
+
+	"github.com/rs/zerolog"
+)
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+		}
+	}
+
+	check(c.Port > 0 && c.Port < 1<<16, "server.port", "%d is out of range", c.Port)
+	check(c.ReadTimeout >= 0, "server.read_timeout", "must not be negative")
+	check(c.ReadHeaderTimeout > 0, "server.read_header_timeout", "must be positive")
+	check(c.WriteTimeout >= 0, "server.write_timeout", "must not be negative")
+	check(c.IdleTimeout >= 0, "server.idle_timeout", "must not be negative")
+	check(c.ShutdownTimeout > 0, "server.shutdown_timeout", "must be positive")
+	check(c.DrainPeriod >= 0, "server.drain_period", "must not be negative")
+	check((c.TLSCert == "") == (c.TLSKey == ""), "server.tls_key", "tls_cert and tls_key must be set together")
+	check(c.TLSClientCA == "" || c.TLSCert != "", "server.tls_client_ca", "requires server.tls_cert")
+	clientAuth := []string{ClientAuthOptional, ClientAuthRequire}
+	check(slices.Contains(clientAuth, c.TLSClientAuth), "server.tls_client_auth", "unknown policy %q", c.TLSClientAuth)
+	check(c.TLSClientAuth != ClientAuthRequire || c.TLSClientCA != "", "server.tls_client_auth",
+		"require needs server.tls_client_ca")
+	check(!c.H2C || c.TLSCert == "", "server.h2c", "is only for plain http, tls already negotiates h2")
+
+	backends := []string{StoragePostgres, StorageSQLite, StorageMemory}
+	check(slices.Contains(backends, c.Storage), "storage.backend", "unknown backend %q", c.Storage)
+	check(c.Storage != StorageSQLite || c.SQLitePath != "", "storage.sqlite_path", "is required for sqlite")
+	check(c.Storage != StoragePostgres || c.DbDSN != "", "db.dsn", "is required for postgres")
+	check(c.DBMaxConns > 0, "db.max_conns", "must be positive")
+	check(c.DBMinConns >= 0 && c.DBMinConns <= c.DBMaxConns, "db.min_conns",
+		"must be between 0 and db.max_conns (%d)", c.DBMaxConns)
+	check(c.DBHealthCheck >= 0, "db.health_check_period", "must not be negative")
+	check(c.DBStatementCache >= 0, "db.statement_cache", "must not be negative")
+
+	check(c.JWTSecret != "", "auth.jwt_secret", "is required")
+	check(c.JWTTTL > 0, "auth.jwt_ttl", "must be positive")
+	check(!c.CORSCredentials || !slices.Contains(c.CORSOrigins, "*"), "cors.allow_credentials",
+		"cannot be used with the * origin")
+	if c.CookieMode {
+		check(c.CookieName != "" && c.CSRFCookieName != "" && c.CookieName != c.CSRFCookieName,
+			"auth.cookie_name", "session and csrf cookies need two different names")
+		sameSite := []string{SameSiteLax, SameSiteStrict, SameSiteNone}
+		check(slices.Contains(sameSite, c.CookieSameSite), "auth.cookie_samesite", "unknown mode %q", c.CookieSameSite)
+		check(c.CookieSameSite != SameSiteNone || c.CookieSecure, "auth.cookie_samesite",
+			"none needs auth.cookie_secure")
+		check(len(c.CORSOrigins) == 0 || c.CORSCredentials, "cors.allow_credentials",
+			"is required for cookie mode with cross-origin front ends")
+	}
+	deprecated, err := time.Parse(time.DateOnly, c.APIV1Deprecated)
+	check(err == nil, "api.v1_deprecated", "%q is not a date like 2006-01-02", c.APIV1Deprecated)
+	if c.APIV1Sunset != "" {
+		sunset, err := time.Parse(time.DateOnly, c.APIV1Sunset)
+		check(err == nil, "api.v1_sunset", "%q is not a date like 2006-01-02", c.APIV1Sunset)
+		check(err != nil || sunset.After(deprecated), "api.v1_sunset", "must be after api.v1_deprecated")
+	}
+	check(c.HSTSMaxAge >= 0, "security.hsts_max_age", "must not be negative")
+	check(c.CORSMaxAge >= 0, "cors.max_age", "must not be negative")
+
+	stores := []string{RateLimitMemory, RateLimitPostgres}
+	check(slices.Contains(stores, c.RateLimitStore), "ratelimit.store", "unknown store %q", c.RateLimitStore)
+	check(c.RateLimitStore != RateLimitPostgres || c.Storage == StoragePostgres, "ratelimit.store",
+		"postgres needs storage.backend postgres")
+	for key, spec := range map[string]string{
+		"ratelimit.auth":  c.RateLimitAuth,
+		"ratelimit.login": c.RateLimitLogin,
+		"ratelimit.books": c.RateLimitBooks,
+		"ratelimit.admin": c.RateLimitAdmin,
+	} {
+		if _, err := ratelimit.ParseLimit(spec); err != nil {
+			check(false, key, "%v", err)
+		}
+	}
+	check(c.LockoutAttempts >= 0, "lockout.attempts", "must not be negative")
+	check(c.LockoutAttempts == 0 || c.LockoutBase > 0, "lockout.base", "must be positive")
+	check(c.LockoutMax >= c.LockoutBase, "lockout.max", "must not be less than lockout.base")
+	check(c.LockoutAttempts == 0 || c.LockoutWindow > 0, "lockout.window", "must be positive")
+	if _, err := scheduler.ParseSchedule(c.RateLimitSweep); err != nil {
+		check(false, "ratelimit.cleanup_schedule", "%v", err)
+	}
+
+	check(c.OutboxRetention > 0, "outbox.retention", "must be positive")
+	if _, err := scheduler.ParseSchedule(c.OutboxSweep); err != nil {
+		check(false, "outbox.cleanup_schedule", "%v", err)
+	}
+
+	check(c.Retention > 0, "purge.retention", "must be positive")
+	if _, err := scheduler.ParseSchedule(c.PurgeSchedule); err != nil {
+		check(false, "purge.schedule", "%v", err)
+	}
+	check(c.PurgeRetries >= 0, "purge.retries", "must not be negative")
+	check(c.PurgeBackoff >= 0, "purge.backoff", "must not be negative")
+	check(c.LeaseTTL > 0, "leader.lease_ttl", "must be positive")
+
+	if lvl, err := zerolog.ParseLevel(c.LogLevel); err != nil || lvl == zerolog.NoLevel {
+		check(false, "log.level", "unknown level %q", c.LogLevel)
+	}
+	formats := []string{logger.FormatJSON, logger.FormatConsole}
+	check(slices.Contains(formats, c.LogFormat), "log.format", "unknown format %q", c.LogFormat)
+	check(c.LogMaxSizeMB >= 0, "log.max_size_mb", "must not be negative")
+	check(c.LogMaxBackups >= 0, "log.max_backups", "must not be negative")
+	check(c.LogMaxAgeDays >= 0, "log.max_age_days", "must not be negative")
+	check(c.LogRotateEvery >= 0, "log.rotate_every", "must not be negative")
+	check(c.LogDebugBurst >= 0, "log.debug_burst", "must not be negative")
+
+	exporters := []string{tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout}
+	check(slices.Contains(exporters, c.TraceExporter), "trace.exporter", "unknown exporter %q", c.TraceExporter)
+	check(c.TraceSampleRatio >= 0 && c.TraceSampleRatio <= 1, "trace.sample_ratio", "must be between 0 and 1")
+
+	return errors.Join(errs...)
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,11 +22,20 @@ type UserLogin struct {
 }
 
 type Book struct {
-	BID         uuid.UUID `json:"bid"`
-	Lable       string    `json:"lable" validate:"required"`
-	Author      string    `json:"author" validate:"required"`
-	Description string    `json:"desc" validate:"required"`
-	WritedAt    time.Time `json:"writed_at" validate:"required"`
+	BID         uuid.UUID  `json:"bid"`
+	Lable       string     `json:"lable" validate:"required"`
+	Author      string     `json:"author" validate:"required"`
+	Description string     `json:"desc" validate:"required"`
+	WritedAt    time.Time  `json:"writed_at" validate:"required"`
+	Owner       string     `json:"-"` // only the trash view shows the owner
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy   string     `json:"deleted_by,omitempty"`
+}
+
+// TrashedBook is a book as the trash view shows it.
+type TrashedBook struct {
+	Book
+	Owner string `json:"owner"`
 }
 
 type BookRequest struct {
@@ -35,3 +45,93 @@ type BookRequest struct {
 	Description string    `json:"desc" validate:"required"`
 	WritedAt    string    `json:"writed_at" validate:"required"`
 }
+
+// BookV2 is a book as /api/v2 shows it.
+type BookV2 struct {
+	BID         uuid.UUID `json:"bid"`
+	Title       string    `json:"title"`
+	Author      string    `json:"author"`
+	Description string    `json:"description"`
+	PublishedAt string    `json:"published_at"`
+}
+
+// TrashedBookV2 is a book as the /api/v2 trash view shows it.
+type TrashedBookV2 struct {
+	BookV2
+	Owner     string     `json:"owner"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+}
+
+type BookRequestV2 struct {
+	Title       string `json:"title" validate:"required"`
+	Author      string `json:"author" validate:"required"`
+	Description string `json:"description" validate:"required"`
+	PublishedAt string `json:"published_at" validate:"required"`
+}
+
+type Webhook struct {
+	ID        uuid.UUID `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookRequest struct {
+	URL    string   `json:"url" validate:"required,url"`
+	Secret string   `json:"secret" validate:"required,min=16"`
+	Events []string `json:"events" validate:"required,min=1,dive,oneof=book.created book.deleted book.restored book.purged user.registered"` //nolint:lll //validation tag
+}
+
+type WebhookDelivery struct {
+	ID           uuid.UUID       `json:"id"`
+	WebhookID    uuid.UUID       `json:"webhook_id"`
+	Event        string          `json:"event"`
+	Payload      json.RawMessage `json:"payload"`
+	Status       string          `json:"status"`
+	Attempts     int             `json:"attempts"`
+	ResponseCode int             `json:"response_code,omitempty"`
+	LastError    string          `json:"last_error,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+	DeliveredAt  *time.Time      `json:"delivered_at,omitempty"`
+}
+
+type AuditEntry struct {
+	ID        uuid.UUID       `json:"id"`
+	At        time.Time       `json:"at"`
+	ActorUID  string          `json:"actor_uid,omitempty"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entity_id,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	IP        string          `json:"ip,omitempty"`
+}
+
+type AuditFilter struct {
+	ActorUID string
+	Action   string
+	Entity   string
+	EntityID string
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Offset   int
+}
+
+type JobState struct {
+	Name           string     `json:"name"`
+	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
+	LastSuccessAt  *time.Time `json:"last_success_at,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	LastResult     int        `json:"last_result"`
+	LastDurationMS int64      `json:"last_duration_ms"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty"`
+	RunsTotal      int64      `json:"runs_total"`
+	FailuresTotal  int64      `json:"failures_total"`
+	AffectedTotal  int64      `json:"affected_total"`
+	// TriggerRequestedAt is set by a manual trigger until the leader runs the job.
+	TriggerRequestedAt *time.Time `json:"trigger_requested_at,omitempty"`
+}
@@ -0,0 +1,57 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+type Handler func(context.Context, Event) error
+
+type subscriber struct {
+	name    string
+	handler Handler
+	types   []Type
+}
+
+type Bus struct {
+	mu   sync.RWMutex
+	subs []subscriber
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers handler for the given event types; no types means every event.
+func (b *Bus) Subscribe(name string, handler Handler, types ...Type) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs = append(b.subs, subscriber{name: name, handler: handler, types: types})
+}
+
+// Dispatch calls the subscribers of evt that are not named in skip and
+// returns the names of those that handled it.
+func (b *Bus) Dispatch(ctx context.Context, evt Event, skip []string) ([]string, error) {
+	b.mu.RLock()
+	subs := slices.Clone(b.subs)
+	b.mu.RUnlock()
+	var done []string
+	var errs []error
+	for _, sub := range subs {
+		if len(sub.types) > 0 && !slices.Contains(sub.types, evt.Type) {
+			continue
+		}
+		if slices.Contains(skip, sub.name) {
+			continue
+		}
+		if err := sub.handler(ctx, evt); err != nil {
+			errs = append(errs, fmt.Errorf("subscriber %s: %w", sub.name, err))
+			continue
+		}
+		done = append(done, sub.name)
+	}
+	return done, errors.Join(errs...)
+}
@@ -0,0 +1,96 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/google/uuid"
+)
+
+type Type string
+
+const (
+	BookCreated    Type = "book.created"
+	BookDeleted    Type = "book.deleted"
+	BookRestored   Type = "book.restored"
+	BookPurged     Type = "book.purged"
+	UserRegistered Type = "user.registered"
+	// AuditRecorded carries an audit entry through the outbox, so the entry
+	// is stored in the transaction of the change it describes. Webhooks never
+	// see it.
+	AuditRecorded Type = "audit.recorded"
+)
+
+// Public are the event types webhooks can subscribe to.
+var Public = []Type{BookCreated, BookDeleted, BookRestored, BookPurged, UserRegistered}
+
+type Event struct {
+	ID         uuid.UUID       `json:"id"`
+	Type       Type            `json:"type"`
+	Payload    json.RawMessage `json:"payload"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
+
+type BookDeletedPayload struct {
+	BID       string `json:"bid"`
+	DeletedBy string `json:"deleted_by,omitempty"`
+}
+
+type BookRestoredPayload struct {
+	BID string `json:"bid"`
+}
+
+type BookPurgedPayload struct {
+	PurgedAt      time.Time `json:"purged_at"`
+	DeletedBefore time.Time `json:"deleted_before"`
+}
+
+type UserRegisteredPayload struct {
+	UID   string `json:"uid"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func New(typ Type, payload any) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:         uuid.New(),
+		Type:       typ,
+		Payload:    data,
+		OccurredAt: time.Now().UTC(),
+	}, nil
+}
+
+func NewBookCreated(book models.Book) (Event, error) {
+	return New(BookCreated, book)
+}
+
+func NewBookDeleted(bid, deletedBy string) (Event, error) {
+	return New(BookDeleted, BookDeletedPayload{BID: bid, DeletedBy: deletedBy})
+}
+
+func NewBookRestored(bid string) (Event, error) {
+	return New(BookRestored, BookRestoredPayload{BID: bid})
+}
+
+func NewBookPurged(before time.Time) (Event, error) {
+	return New(BookPurged, BookPurgedPayload{PurgedAt: time.Now().UTC(), DeletedBefore: before.UTC()})
+}
+
+func NewUserRegistered(user models.User) (Event, error) {
+	return New(UserRegistered, UserRegisteredPayload{
+		UID:   user.UID.String(),
+		Name:  user.Name,
+		Email: user.Email,
+	})
+}
+
+func Decode[T any](evt Event) (T, error) {
+	var payload T
+	err := json.Unmarshal(evt.Payload, &payload)
+	return payload, err
+}
@@ -0,0 +1,9 @@
+package events
+
+import "context"
+
+const MaxAttempts = relayMaxAttempts
+
+func (r *Relay) Flush(ctx context.Context) {
+	r.flush(ctx)
+}
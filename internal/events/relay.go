@@ -0,0 +1,117 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+)
+
+const (
+	relayBatchSize = 100
+	// relayMaxAttempts is how often an event is dispatched before it is
+	// moved to the dead letter state.
+	relayMaxAttempts = 10
+	relayMaxBackoff  = 10 * time.Minute
+)
+
+// CleanupJobName is the scheduler job that deletes dispatched events.
+const CleanupJobName = "outbox-cleanup"
+
+type Outbox interface {
+	// FetchPending returns events that are neither dispatched nor dead and
+	// whose retry time has passed, oldest first.
+	FetchPending(ctx context.Context, limit int) ([]Pending, error)
+	MarkDispatched(ctx context.Context, id string) error
+	MarkFailed(ctx context.Context, id string, f Failure) error
+	// DeleteDispatched deletes events dispatched more than retention ago
+	// and returns how many. Dead events are kept.
+	DeleteDispatched(ctx context.Context, retention time.Duration) (int, error)
+}
+
+// Pending is an outbox event with the outcome of its earlier attempts.
+type Pending struct {
+	Event
+	Attempts int
+	// Delivered names the subscribers that already handled the event.
+	Delivered []string
+}
+
+// Failure records a failed attempt to dispatch an event.
+type Failure struct {
+	Attempts  int
+	Delivered []string
+	Error     string
+	RetryAt   time.Time
+	// Dead stops further attempts, the event stays in the outbox for
+	// inspection.
+	Dead bool
+}
+
+type Relay struct {
+	outbox   Outbox
+	bus      *Bus
+	interval time.Duration
+}
+
+func NewRelay(outbox Outbox, bus *Bus, interval time.Duration) *Relay {
+	return &Relay{outbox: outbox, bus: bus, interval: interval}
+}
+
+func (r *Relay) Run(ctx context.Context) error {
+	log := logger.Get()
+	defer log.Debug().Msg("outbox relay stoped")
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.interval):
+			r.flush(ctx)
+		}
+	}
+}
+
+// flush dispatches a batch. A failing event is retried later with backoff
+// and only to the subscribers that have not handled it, so it never holds
+// up the events behind it.
+func (r *Relay) flush(ctx context.Context) {
+	log := logger.Get()
+	evts, err := r.outbox.FetchPending(ctx, relayBatchSize)
+	if err != nil {
+		log.Error().Err(err).Msg("fetch outbox events failed")
+		return
+	}
+	for _, evt := range evts {
+		elog := log.With().Str("event", evt.ID.String()).Str("type", string(evt.Type)).Logger()
+		done, err := r.bus.Dispatch(ctx, evt.Event, evt.Delivered)
+		if err == nil {
+			if err = r.outbox.MarkDispatched(ctx, evt.ID.String()); err != nil {
+				elog.Error().Err(err).Msg("mark event dispatched failed")
+			}
+			continue
+		}
+		f := Failure{
+			Attempts:  evt.Attempts + 1,
+			Delivered: append(evt.Delivered, done...),
+			Error:     err.Error(),
+		}
+		if f.Attempts >= relayMaxAttempts {
+			f.Dead = true
+			elog.Error().Err(err).Int("attempts", f.Attempts).Msg("event moved to dead letter")
+		} else {
+			f.RetryAt = time.Now().Add(r.backoff(f.Attempts))
+			elog.Warn().Err(err).Int("attempts", f.Attempts).Time("retry_at", f.RetryAt).Msg("dispatch event failed")
+		}
+		if err = r.outbox.MarkFailed(ctx, evt.ID.String(), f); err != nil {
+			elog.Error().Err(err).Msg("mark event failed failed")
+		}
+	}
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.interval << min(attempts, 20)
+	if d <= 0 || d > relayMaxBackoff {
+		return relayMaxBackoff
+	}
+	return d
+}
@@ -0,0 +1,141 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/events"
+)
+
+// memOutbox ignores retry times, so every Flush is a new attempt.
+type memOutbox struct {
+	order   []string
+	pending map[string]*events.Pending
+	dead    map[string]events.Failure
+}
+
+func newOutbox(evts ...events.Event) *memOutbox {
+	mo := &memOutbox{pending: make(map[string]*events.Pending), dead: make(map[string]events.Failure)}
+	for _, evt := range evts {
+		mo.order = append(mo.order, evt.ID.String())
+		mo.pending[evt.ID.String()] = &events.Pending{Event: evt}
+	}
+	return mo
+}
+
+func (mo *memOutbox) FetchPending(_ context.Context, limit int) ([]events.Pending, error) {
+	var out []events.Pending
+	for _, id := range mo.order {
+		if p, ok := mo.pending[id]; ok && len(out) < limit {
+			out = append(out, *p)
+		}
+	}
+	return out, nil
+}
+
+func (mo *memOutbox) MarkDispatched(_ context.Context, id string) error {
+	delete(mo.pending, id)
+	return nil
+}
+
+func (mo *memOutbox) MarkFailed(_ context.Context, id string, f events.Failure) error {
+	if f.Dead {
+		delete(mo.pending, id)
+		mo.dead[id] = f
+		return nil
+	}
+	mo.pending[id].Attempts = f.Attempts
+	mo.pending[id].Delivered = f.Delivered
+	return nil
+}
+
+func (mo *memOutbox) DeleteDispatched(context.Context, time.Duration) (int, error) {
+	return 0, nil
+}
+
+type recorder struct {
+	got  []string
+	fail func(events.Event) bool
+}
+
+func (rc *recorder) handle(_ context.Context, evt events.Event) error {
+	if rc.fail != nil && rc.fail(evt) {
+		return errors.New("subscriber down")
+	}
+	rc.got = append(rc.got, evt.ID.String())
+	return nil
+}
+
+func newEvents(t *testing.T, n int) []events.Event {
+	t.Helper()
+	evts := make([]events.Event, n)
+	for i := range evts {
+		evt, err := events.NewBookRestored("book")
+		if err != nil {
+			t.Fatal(err)
+		}
+		evts[i] = evt
+	}
+	return evts
+}
+
+func TestRelayRetriesOnlyFailedSubscriber(t *testing.T) {
+	evts := newEvents(t, 2)
+	first, second := evts[0].ID.String(), evts[1].ID.String()
+	outbox := newOutbox(evts...)
+	healthy := &recorder{}
+	down := true
+	flaky := &recorder{fail: func(evt events.Event) bool { return down && evt.ID == evts[0].ID }}
+	bus := events.NewBus()
+	bus.Subscribe("healthy", healthy.handle)
+	bus.Subscribe("flaky", flaky.handle)
+	relay := events.NewRelay(outbox, bus, time.Millisecond)
+
+	relay.Flush(context.Background())
+	if !slices.Equal(flaky.got, []string{second}) {
+		t.Fatalf("flaky got %v, want only the second event", flaky.got)
+	}
+	if p := outbox.pending[first]; p == nil || p.Attempts != 1 || !slices.Equal(p.Delivered, []string{"healthy"}) {
+		t.Fatalf("first event after a failure: %+v", p)
+	}
+
+	relay.Flush(context.Background())
+	down = false
+	relay.Flush(context.Background())
+	if len(outbox.pending) != 0 {
+		t.Fatalf("%d events still pending", len(outbox.pending))
+	}
+	if !slices.Equal(healthy.got, []string{first, second}) {
+		t.Fatalf("healthy got %v, want each event once", healthy.got)
+	}
+	if !slices.Equal(flaky.got, []string{second, first}) {
+		t.Fatalf("flaky got %v", flaky.got)
+	}
+}
+
+func TestRelayDeadLettersPoisonEvent(t *testing.T) {
+	evts := newEvents(t, 2)
+	poison := evts[0].ID.String()
+	outbox := newOutbox(evts...)
+	rc := &recorder{fail: func(evt events.Event) bool { return evt.ID == evts[0].ID }}
+	bus := events.NewBus()
+	bus.Subscribe("indexer", rc.handle)
+	relay := events.NewRelay(outbox, bus, time.Millisecond)
+
+	for range events.MaxAttempts + 2 {
+		relay.Flush(context.Background())
+	}
+	if !slices.Equal(rc.got, []string{evts[1].ID.String()}) {
+		t.Fatalf("got %v, want the event behind the poison one", rc.got)
+	}
+	f, ok := outbox.dead[poison]
+	if !ok || f.Attempts != events.MaxAttempts || f.Error == "" {
+		t.Fatalf("poison event: dead %v, failure %+v", ok, f)
+	}
+	if len(outbox.pending) != 0 {
+		t.Fatalf("%d events still pending", len(outbox.pending))
+	}
+}
@@ -0,0 +1,85 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+type Component struct {
+	Status  Status         `json:"status"`
+	Error   string         `json:"error,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+type Report struct {
+	Status     Status               `json:"status"`
+	Components map[string]Component `json:"components"`
+}
+
+type CheckFunc func(ctx context.Context) Component
+
+type Checker struct {
+	mu      sync.RWMutex
+	checks  map[string]CheckFunc
+	timeout time.Duration
+}
+
+func New(timeout time.Duration) *Checker {
+	return &Checker{
+		checks:  make(map[string]CheckFunc),
+		timeout: timeout,
+	}
+}
+
+func (c *Checker) Register(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = fn
+}
+
+// Check runs all checks concurrently, each bounded by the checker timeout.
+// The report is up only when every component is up.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	report := Report{Status: StatusUp, Components: make(map[string]Component, len(c.checks))}
+	for name, fn := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+			comp := fn(cCtx)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[name] = comp
+			if comp.Status != StatusUp {
+				report.Status = StatusDown
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+func Up(details map[string]any) Component {
+	return Component{Status: StatusUp, Details: details}
+}
+
+func Down(err error, details map[string]any) Component {
+	comp := Component{Status: StatusDown, Details: details}
+	if err != nil {
+		comp.Error = err.Error()
+	}
+	return comp
+}
@@ -0,0 +1,117 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/google/uuid"
+)
+
+const releaseTimeout = 5 * time.Second
+
+type LeaseStorage interface {
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, name, holder string) error
+}
+
+type Elector struct {
+	stor   LeaseStorage
+	name   string
+	holder string
+	ttl    time.Duration
+	leader atomic.Bool
+}
+
+// New returns an elector for the named lease. A nil stor makes this instance
+// the leader unconditionally, which is what single-process storages need.
+func New(stor LeaseStorage, name string, ttl time.Duration) *Elector {
+	host, _ := os.Hostname()
+	return &Elector{
+		stor:   stor,
+		name:   name,
+		holder: fmt.Sprintf("%s-%s", host, uuid.NewString()),
+		ttl:    ttl,
+	}
+}
+
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run calls fn whenever this instance holds the lease and cancels its context
+// as soon as the lease is lost. On shutdown the lease is released so another
+// replica can take over without waiting for it to expire.
+func (e *Elector) Run(ctx context.Context, fn func(context.Context) error) error {
+	if e.stor == nil {
+		e.leader.Store(true)
+		defer e.leader.Store(false)
+		return fn(ctx)
+	}
+	log := logger.Get().With().Str("lease", e.name).Str("holder", e.holder).Logger()
+	retry := e.ttl / 3
+	for {
+		ok, err := e.stor.AcquireLease(ctx, e.name, e.holder, e.ttl)
+		if err != nil {
+			log.Error().Err(err).Msg("acquire lease failed")
+		}
+		if ok {
+			log.Info().Msg("became leader")
+			if err = e.lead(ctx, fn); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retry):
+		}
+	}
+}
+
+func (e *Elector) lead(ctx context.Context, fn func(context.Context) error) error {
+	log := logger.Get().With().Str("lease", e.name).Str("holder", e.holder).Logger()
+	e.leader.Store(true)
+	defer e.leader.Store(false)
+
+	leadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- fn(leadCtx) }()
+
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			e.release(ctx)
+			return err
+		case <-ctx.Done():
+			cancel()
+			err := <-done
+			e.release(ctx)
+			log.Info().Msg("lease released on shutdown")
+			return err
+		case <-ticker.C:
+			ok, err := e.stor.AcquireLease(ctx, e.name, e.holder, e.ttl)
+			if err != nil || !ok {
+				log.Warn().Err(err).Msg("lost leadership")
+				cancel()
+				<-done
+				return nil
+			}
+		}
+	}
+}
+
+func (e *Elector) release(ctx context.Context) {
+	log := logger.Get()
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+	defer cancel()
+	if err := e.stor.ReleaseLease(ctx, e.name, e.holder); err != nil {
+		log.Error().Err(err).Str("lease", e.name).Msg("release lease failed")
+	}
+}
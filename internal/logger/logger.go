@@ -1,18 +1,112 @@
 package logger
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-var once sync.Once
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+type Config struct {
+	Level  string
+	Format string
+	// File switches output from stdout to a rotated file.
+	File        string
+	MaxSizeMB   int
+	MaxBackups  int
+	MaxAgeDays  int
+	RotateEvery time.Duration
+	// DebugBurst limits debug events per second, 0 disables sampling.
+	DebugBurst uint32
+	// RedactFields are JSON keys whose values never reach the output.
+	RedactFields []string
+}
+
+var DefaultRedactFields = []string{"pass", "password", "secret", "token", "authorization", "cookie", "email"}
+
+var (
+	once    sync.Once
+	current atomic.Pointer[zerolog.Logger]
+	closer  io.Closer
+)
 
-var log zerolog.Logger
+// Init builds the global logger from cfg. Loggers taken with Get before
+// Init keep writing with the defaults.
+func Init(cfg Config) error {
+	l, c, err := build(cfg)
+	if err != nil {
+		return err
+	}
+	setup()
+	prev := closer
+	closer = c
+	current.Store(&l)
+	if prev != nil {
+		return prev.Close()
+	}
+	return nil
+}
 
+// Get returns the global logger, falling back to stdout JSON at info level
+// (debug console output if the first flag is set) when Init was not called.
 func Get(flags ...bool) zerolog.Logger {
+	if l := current.Load(); l != nil {
+		return *l
+	}
+	cfg := Config{Level: zerolog.InfoLevel.String(), Format: FormatJSON}
+	if len(flags) > 0 && flags[0] {
+		cfg = Config{Level: zerolog.DebugLevel.String(), Format: FormatConsole}
+	}
+	l, _, err := build(cfg)
+	if err != nil {
+		panic(err)
+	}
+	setup()
+	current.CompareAndSwap(nil, &l)
+	return *current.Load()
+}
+
+func Close() error {
+	if closer == nil {
+		return nil
+	}
+	return closer.Close()
+}
+
+func SetLevel(level string) error {
+	lvl, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	if lvl == zerolog.NoLevel {
+		return fmt.Errorf("empty log level")
+	}
+	zerolog.SetGlobalLevel(lvl)
+	return nil
+}
+
+func Level() string {
+	return zerolog.GlobalLevel().String()
+}
+
+func DebugEnabled() bool {
+	return zerolog.GlobalLevel() <= zerolog.DebugLevel
+}
+
+func setup() {
 	once.Do(func() {
 		zerolog.TimestampFieldName = "Time"
 		zerolog.LevelFieldName = "Level"
@@ -27,17 +121,120 @@ func Get(flags ...bool) zerolog.Logger {
 			file = short
 			return file + ":" + strconv.Itoa(line)
 		}
-		if flags[0] {
-			log = zerolog.New(os.Stdout).
-				Level(zerolog.DebugLevel).
-				With().
-				Timestamp().
-				Caller().
-				Logger().
-				Output(zerolog.ConsoleWriter{Out: os.Stderr})
-		} else {
-			log = zerolog.New(os.Stdout).Level(zerolog.InfoLevel).With().Timestamp().Caller().Logger()
-		}
 	})
-	return log
+}
+
+func build(cfg Config) (zerolog.Logger, io.Closer, error) {
+	if err := SetLevel(cfg.Level); err != nil {
+		return zerolog.Logger{}, nil, err
+	}
+	fields := cfg.RedactFields
+	if fields == nil {
+		fields = DefaultRedactFields
+	}
+	setRedactFields(fields)
+
+	var out io.Writer
+	var c io.Closer
+	switch {
+	case cfg.File != "":
+		file := &rotatingFile{Logger: &lumberjack.Logger{
+			Filename:   cfg.File,
+			MaxSize:    cfg.MaxSizeMB,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAgeDays,
+		}}
+		if cfg.RotateEvery > 0 {
+			file.stop = make(chan struct{})
+			file.done = make(chan struct{})
+			go file.rotate(cfg.RotateEvery)
+		}
+		out, c = file, file
+	case cfg.Format == FormatConsole:
+		out = os.Stderr
+	default:
+		out = os.Stdout
+	}
+	switch cfg.Format {
+	case FormatConsole:
+		out = zerolog.ConsoleWriter{Out: out, NoColor: cfg.File != ""}
+	case FormatJSON, "":
+	default:
+		return zerolog.Logger{}, nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	// The level is filtered globally so it can change at runtime.
+	l := zerolog.New(redactWriter{next: out}).
+		Level(zerolog.TraceLevel).
+		With().
+		Timestamp().
+		Caller().
+		Logger().
+		Hook(traceHook{})
+	if cfg.DebugBurst > 0 {
+		l = l.Sample(&zerolog.LevelSampler{
+			DebugSampler: &zerolog.BurstSampler{Burst: cfg.DebugBurst, Period: time.Second},
+		})
+	}
+	return l, c, nil
+}
+
+// rotatingFile also rotates on a timer. Close stops the timer before closing
+// the file, so a replaced logger does not keep rotating it.
+type rotatingFile struct {
+	*lumberjack.Logger
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (f *rotatingFile) rotate(every time.Duration) {
+	defer close(f.done)
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			if err := f.Rotate(); err != nil {
+				fmt.Fprintf(os.Stderr, "rotate log file: %v\n", err)
+			}
+		}
+	}
+}
+
+func (f *rotatingFile) Close() error {
+	if f.stop != nil {
+		f.closeOnce.Do(func() { close(f.stop) })
+		<-f.done
+	}
+	return f.Logger.Close()
+}
+
+// traceHook adds the active span to events logged with a context, see zerolog.Event.Ctx.
+type traceHook struct{}
+
+func (traceHook) Run(e *zerolog.Event, _ zerolog.Level, _ string) {
+	sc := trace.SpanContextFromContext(e.GetCtx())
+	if sc.IsValid() {
+		e.Str("trace_id", sc.TraceID().String()).Str("span_id", sc.SpanID().String())
+	}
+}
+
+type ctxKey struct{}
+
+// WithContext stores a request-scoped logger in ctx.
+func WithContext(ctx context.Context, l zerolog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger stored by WithContext, or the global one
+// bound to ctx so trace ids still get attached.
+func FromContext(ctx context.Context) zerolog.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(zerolog.Logger); ok {
+		return l
+	}
+	l := Get()
+	return l.With().Ctx(ctx).Logger()
 }
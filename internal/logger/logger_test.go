@@ -0,0 +1,115 @@
+package logger_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+)
+
+// logTo sends the global logger to a file in a temp dir and returns a func
+// that closes it and reads what was written.
+func logTo(t *testing.T, cfg logger.Config) func() string {
+	t.Helper()
+	if cfg.File == "" {
+		cfg.File = filepath.Join(t.TempDir(), "bookly.log")
+	}
+	if cfg.Level == "" {
+		cfg.Level = "debug"
+	}
+	if err := logger.Init(cfg); err != nil {
+		t.Fatalf("init logger: %v", err)
+	}
+	return func() string {
+		t.Helper()
+		if err := logger.Close(); err != nil {
+			t.Fatalf("close logger: %v", err)
+		}
+		data, err := os.ReadFile(cfg.File)
+		if err != nil {
+			t.Fatalf("read log: %v", err)
+		}
+		return string(data)
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	// Init sets the default redact fields.
+	if err := logger.Init(logger.Config{Level: "disabled", Format: logger.FormatJSON}); err != nil {
+		t.Fatalf("init logger: %v", err)
+	}
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "top level", in: `{"email":"a@b.c","name":"ann"}`, want: `{"email":"[REDACTED]","name":"ann"}`},
+		{name: "nested object", in: `{"user":{"Password":"x","age":3}}`, want: `{"user":{"Password":"[REDACTED]","age":3}}`},
+		{name: "object in array", in: `{"hooks":[{"secret":"s"},{"url":"u"}]}`,
+			want: `{"hooks":[{"secret":"[REDACTED]"},{"url":"u"}]}`},
+		{name: "whole subtree", in: `{"token":{"raw":"t"}}`, want: `{"token":"[REDACTED]"}`},
+		{name: "sensitive value only", in: `{"note":"password"}`, want: `{"note":"password"}`},
+		{name: "big number", in: `{"id":12345678901234567890}`, want: `{"id":12345678901234567890}`},
+		{name: "not json", in: `pass=x`, want: ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(logger.RedactJSON([]byte(tt.in))); got != tt.want {
+				t.Fatalf("RedactJSON(%s) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactOutput(t *testing.T) {
+	for _, format := range []string{logger.FormatJSON, logger.FormatConsole} {
+		t.Run(format, func(t *testing.T) {
+			read := logTo(t, logger.Config{Format: format, RedactFields: []string{"pass", "card"}})
+			log := logger.Get()
+			log.Info().Str("pass", "hunter22").Any("body", map[string]any{
+				"name": "ann", "billing": map[string]string{"Card": "4111111111111111"},
+			}).Msg("signup")
+			out := read()
+			for _, leak := range []string{"hunter22", "4111111111111111"} {
+				if strings.Contains(out, leak) {
+					t.Fatalf("%s reached the %s log: %s", leak, format, out)
+				}
+			}
+			if !strings.Contains(out, logger.Redacted) || !strings.Contains(out, "ann") {
+				t.Fatalf("%s log %s, want the redacted fields and the rest", format, out)
+			}
+			if format == logger.FormatJSON && !json.Valid([]byte(out)) {
+				t.Fatalf("json log is not valid json: %s", out)
+			}
+		})
+	}
+}
+
+func TestRotateStopsOnClose(t *testing.T) {
+	dir := t.TempDir()
+	read := logTo(t, logger.Config{
+		Format: logger.FormatJSON, File: filepath.Join(dir, "bookly.log"), RotateEvery: 5 * time.Millisecond,
+	})
+	log := logger.Get()
+	log.Info().Msg("first")
+	time.Sleep(30 * time.Millisecond)
+	read()
+	before := countFiles(t, dir)
+	time.Sleep(30 * time.Millisecond)
+	if after := countFiles(t, dir); after != before {
+		t.Fatalf("%d log files after close, %d before: rotation kept running", after, before)
+	}
+}
+
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read log dir: %v", err)
+	}
+	return len(entries)
+}
@@ -0,0 +1,101 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+const Redacted = "[REDACTED]"
+
+var redactFields atomic.Pointer[map[string]struct{}]
+
+func setRedactFields(fields []string) {
+	set := make(map[string]struct{}, len(fields))
+	for _, f := range fields {
+		if f = strings.ToLower(strings.TrimSpace(f)); f != "" {
+			set[f] = struct{}{}
+		}
+	}
+	redactFields.Store(&set)
+}
+
+func sensitive(key string) bool {
+	set := redactFields.Load()
+	if set == nil {
+		return false
+	}
+	_, ok := (*set)[strings.ToLower(key)]
+	return ok
+}
+
+// RedactJSON returns raw with the values of sensitive keys replaced, at any
+// depth. It returns nil when raw is not valid JSON.
+func RedactJSON(raw []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil
+	}
+	out, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func redactValue(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, field := range val {
+			if sensitive(k) {
+				val[k] = Redacted
+				continue
+			}
+			val[k] = redactValue(field)
+		}
+	case []any:
+		for i := range val {
+			val[i] = redactValue(val[i])
+		}
+	}
+	return v
+}
+
+// redactWriter scrubs every JSON log line before it reaches the output.
+// Lines without any sensitive key are passed through untouched.
+type redactWriter struct {
+	next io.Writer
+}
+
+func (w redactWriter) Write(p []byte) (int, error) {
+	if !mayContainSensitive(p) {
+		return w.next.Write(p)
+	}
+	line := bytes.TrimRight(p, "\n")
+	out := RedactJSON(line)
+	if out == nil {
+		return w.next.Write(p)
+	}
+	if _, err := w.next.Write(append(out, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func mayContainSensitive(p []byte) bool {
+	set := redactFields.Load()
+	if set == nil || len(*set) == 0 {
+		return false
+	}
+	lower := bytes.ToLower(p)
+	for f := range *set {
+		if bytes.Contains(lower, []byte(`"`+f+`"`)) {
+			return true
+		}
+	}
+	return false
+}
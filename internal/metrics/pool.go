@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type poolCollector struct {
+	stat func() *pgxpool.Stat
+
+	total       *prometheus.Desc
+	idle        *prometheus.Desc
+	acquired    *prometheus.Desc
+	max         *prometheus.Desc
+	acquires    *prometheus.Desc
+	emptyWaits  *prometheus.Desc
+	canceled    *prometheus.Desc
+	acquireTime *prometheus.Desc
+}
+
+// RegisterPool exports pgxpool statistics on every scrape.
+func RegisterPool(stat func() *pgxpool.Stat) {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+	prometheus.MustRegister(&poolCollector{
+		stat:        stat,
+		total:       desc("conns", "Open connections."),
+		idle:        desc("idle_conns", "Idle connections."),
+		acquired:    desc("acquired_conns", "Connections in use."),
+		max:         desc("max_conns", "Pool size limit."),
+		acquires:    desc("acquires_total", "Successful connection acquires."),
+		emptyWaits:  desc("empty_acquires_total", "Acquires that waited for a free connection."),
+		canceled:    desc("canceled_acquires_total", "Acquires canceled by the caller context."),
+		acquireTime: desc("acquire_duration_seconds_total", "Time spent waiting for connections."),
+	})
+}
+
+func (pc *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		pc.total, pc.idle, pc.acquired, pc.max, pc.acquires, pc.emptyWaits, pc.canceled, pc.acquireTime,
+	} {
+		ch <- d
+	}
+}
+
+func (pc *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := pc.stat()
+	ch <- prometheus.MustNewConstMetric(pc.total, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(pc.idle, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(pc.acquired, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(pc.max, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(pc.acquires, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(pc.emptyWaits, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(pc.canceled, prometheus.CounterValue, float64(s.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(pc.acquireTime, prometheus.CounterValue, s.AcquireDuration().Seconds())
+}
@@ -0,0 +1,188 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// Registry collects the schemas of named structs so they are defined once
+// in the components and referenced everywhere else.
+type Registry struct {
+	schemas map[string]*Schema
+}
+
+func NewRegistry() *Registry {
+	return &Registry{schemas: make(map[string]*Schema)}
+}
+
+// Schemas returns the collected component schemas.
+func (r *Registry) Schemas() map[string]*Schema {
+	return r.schemas
+}
+
+// Schema returns the schema of the type of v.
+func (r *Registry) Schema(v any) *Schema {
+	return r.schemaOf(reflect.TypeOf(v))
+}
+
+func (r *Registry) schemaOf(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	case rawType:
+		return &Schema{}
+	}
+	switch t.Kind() { //nolint:exhaustive // channels and funcs never reach the wire
+	case reflect.Pointer:
+		return r.schemaOf(t.Elem())
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: r.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: r.schemaOf(t.Elem())}
+	case reflect.Struct:
+		return r.structRef(t)
+	default:
+		return &Schema{}
+	}
+}
+
+func (r *Registry) structRef(t reflect.Type) *Schema {
+	name := schemaName(t)
+	if _, ok := r.schemas[name]; ok {
+		return Ref(name)
+	}
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	// Registered before the fields so self references terminate.
+	r.schemas[name] = s
+	r.addFields(s, t)
+	return Ref(name)
+}
+
+// addFields adds the JSON fields of struct t to s. Fields of embedded
+// structs are promoted unless t declares a field of the same name, as in
+// encoding/json.
+func (r *Registry) addFields(s *Schema, t reflect.Type) {
+	var embedded []reflect.Type
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		prop, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if prop == "-" {
+			continue
+		}
+		if field.Anonymous && prop == "" && field.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, field.Type)
+			continue
+		}
+		if prop == "" {
+			prop = field.Name
+		}
+		fs := r.schemaOf(field.Type)
+		if applyRules(fs, field.Tag.Get("validate")) {
+			s.Required = append(s.Required, prop)
+		}
+		s.Properties[prop] = fs
+	}
+	for _, et := range embedded {
+		inner := &Schema{Properties: make(map[string]*Schema)}
+		r.addFields(inner, et)
+		for _, prop := range inner.Required {
+			if _, ok := s.Properties[prop]; !ok {
+				s.Required = append(s.Required, prop)
+			}
+		}
+		for prop, fs := range inner.Properties {
+			if _, ok := s.Properties[prop]; !ok {
+				s.Properties[prop] = fs
+			}
+		}
+	}
+}
+
+func schemaName(t reflect.Type) string {
+	name := []rune(t.Name())
+	if len(name) == 0 {
+		return "Object"
+	}
+	name[0] = unicode.ToUpper(name[0])
+	return string(name)
+}
+
+// applyRules turns validate rules into schema constraints and reports
+// whether the field is required. Rules after dive apply to the items.
+func applyRules(s *Schema, rules string) bool {
+	required := false
+	target := s
+	for _, rule := range strings.Split(rules, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = required || target == s
+		case "dive":
+			if target.Items == nil {
+				return required
+			}
+			target = target.Items
+		case "email":
+			target.Format = "email"
+		case "url":
+			target.Format = "uri"
+		case "oneof":
+			target.Enum = strings.Fields(param)
+		case "min", "gte":
+			setBound(target, param, true)
+		case "max", "lte":
+			setBound(target, param, false)
+		}
+	}
+	return required
+}
+
+// setBound sets the lower or upper limit the way validator reads it: length
+// for strings, size for arrays and value for numbers.
+func setBound(s *Schema, param string, lower bool) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+	size := int(n)
+	switch {
+	case s.Type == "string" && lower:
+		s.MinLength = &size
+	case s.Type == "string":
+		s.MaxLength = &size
+	case s.Type == "array" && lower:
+		s.MinItems = &size
+	case s.Type == "array":
+		s.MaxItems = &size
+	case lower:
+		s.Minimum = &n
+	default:
+		s.Maximum = &n
+	}
+}
@@ -0,0 +1,184 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Storage keeps token buckets and failed login counters. The memory storage
+// serves a single replica, the Postgres one shares state between replicas.
+type Storage interface {
+	// TakeToken refills the bucket at rate tokens per second up to burst and
+	// takes one token if there is one. It returns the tokens left.
+	TakeToken(ctx context.Context, key string, rate float64, burst int) (bool, float64, error)
+	// AddLoginFailure counts a failure, starting over when the previous one
+	// is older than window, and returns the failures so far.
+	AddLoginFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	// LoginLock returns the end of the current lock, zero if there is none.
+	LoginLock(ctx context.Context, key string) (time.Time, error)
+	ResetLogin(ctx context.Context, key string) error
+	// DeleteExpired drops buckets that have refilled and failure counters
+	// whose window and lock are both over, both behave like missing ones.
+	// It returns how many were dropped.
+	DeleteExpired(ctx context.Context, window time.Duration) (int, error)
+}
+
+// CleanupJobName is the scheduler job that calls Storage.DeleteExpired.
+const CleanupJobName = "ratelimit-cleanup"
+
+// Limit allows Count requests per Period with bursts of up to Count.
+// The zero Limit does not limit anything.
+type Limit struct {
+	Count  int
+	Period time.Duration
+}
+
+// ParseLimit reads limits written as "count/period", e.g. "10/1m". An empty
+// spec or "0" is no limit.
+func ParseLimit(spec string) (Limit, error) {
+	if spec == "" || spec == "0" {
+		return Limit{}, nil
+	}
+	count, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q: want count/period", spec)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("limit %q: bad count", spec)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("limit %q: bad period", spec)
+	}
+	return Limit{Count: n, Period: d}, nil
+}
+
+func (l Limit) Unlimited() bool {
+	return l.Count == 0
+}
+
+func (l Limit) rate() float64 {
+	return float64(l.Count) / l.Period.Seconds()
+}
+
+// Limiter applies a limit per route group and key, e.g. the client ip.
+type Limiter struct {
+	stor   Storage
+	limits atomic.Pointer[map[string]Limit]
+}
+
+func NewLimiter(stor Storage, limits map[string]Limit) *Limiter {
+	l := &Limiter{stor: stor}
+	l.SetLimits(limits)
+	return l
+}
+
+// SetLimits replaces the limits of all groups at once.
+func (l *Limiter) SetLimits(limits map[string]Limit) {
+	l.limits.Store(&limits)
+}
+
+// Allow takes a token for key in group. When the bucket is empty it returns
+// how long until the next token.
+func (l *Limiter) Allow(ctx context.Context, group, key string) (time.Duration, error) {
+	limit := (*l.limits.Load())[group]
+	if limit.Unlimited() {
+		return 0, nil
+	}
+	ok, tokens, err := l.stor.TakeToken(ctx, group+":"+key, limit.rate(), limit.Count)
+	if err != nil || ok {
+		return 0, err
+	}
+	wait := (1 - tokens) / limit.rate()
+	return time.Duration(math.Ceil(wait * float64(time.Second))), nil
+}
+
+var ErrLocked = errors.New("too many failed login attempts")
+
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s, locked until %s", ErrLocked, e.Until.UTC().Format(time.RFC3339))
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrLocked
+}
+
+type LockoutPolicy struct {
+	// Threshold is the failures before the first lock, 0 disables lockout.
+	Threshold int
+	// Base is the first lock, every further failure doubles it up to Max.
+	Base   time.Duration
+	Max    time.Duration
+	Window time.Duration
+}
+
+// Lockout locks an account out after repeated failed logins.
+type Lockout struct {
+	stor   Storage
+	policy LockoutPolicy
+}
+
+func NewLockout(stor Storage, policy LockoutPolicy) *Lockout {
+	return &Lockout{stor: stor, policy: policy}
+}
+
+// Check returns a *LockedError while key is locked.
+func (l *Lockout) Check(ctx context.Context, key string) error {
+	if l.policy.Threshold == 0 {
+		return nil
+	}
+	until, err := l.stor.LoginLock(ctx, key)
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(until) {
+		return &LockedError{Until: until}
+	}
+	return nil
+}
+
+// Fail records a failed login and returns a *LockedError if it locked key.
+func (l *Lockout) Fail(ctx context.Context, key string) error {
+	if l.policy.Threshold == 0 {
+		return nil
+	}
+	failures, err := l.stor.AddLoginFailure(ctx, key, l.policy.Window)
+	if err != nil {
+		return err
+	}
+	if failures < l.policy.Threshold {
+		return nil
+	}
+	lock := l.policy.Base
+	for range failures - l.policy.Threshold {
+		if lock >= l.policy.Max {
+			break
+		}
+		lock *= 2
+	}
+	lock = min(lock, l.policy.Max)
+	until := time.Now().Add(lock)
+	if err = l.stor.LockLogin(ctx, key, until); err != nil {
+		return err
+	}
+	return &LockedError{Until: until}
+}
+
+func (l *Lockout) Reset(ctx context.Context, key string) error {
+	if l.policy.Threshold == 0 {
+		return nil
+	}
+	return l.stor.ResetLogin(ctx, key)
+}
@@ -0,0 +1,133 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/ratelimit"
+	"github.com/Dorrrke/gt4-bookly/internal/storage"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    ratelimit.Limit
+		wantErr bool
+	}{
+		{spec: "", want: ratelimit.Limit{}},
+		{spec: "0", want: ratelimit.Limit{}},
+		{spec: "10/1m", want: ratelimit.Limit{Count: 10, Period: time.Minute}},
+		{spec: "5/30s", want: ratelimit.Limit{Count: 5, Period: 30 * time.Second}},
+		{spec: "0/1m", want: ratelimit.Limit{Period: time.Minute}},
+		{spec: "10", wantErr: true},
+		{spec: "ten/1m", wantErr: true},
+		{spec: "-1/1m", wantErr: true},
+		{spec: "10/soon", wantErr: true},
+		{spec: "10/0s", wantErr: true},
+		{spec: "10/-1m", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ratelimit.ParseLimit(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLimit(%q) error %v, want error %v", tt.spec, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("ParseLimit(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+			if !tt.wantErr && got.Unlimited() != (got.Count == 0) {
+				t.Fatalf("%+v: Unlimited %v", got, got.Unlimited())
+			}
+		})
+	}
+}
+
+func TestLimiterRefill(t *testing.T) {
+	ctx := context.Background()
+	// 2 per 200ms: a burst of 2, then a token every 100ms.
+	limit := ratelimit.Limit{Count: 2, Period: 200 * time.Millisecond}
+	l := ratelimit.NewLimiter(storage.NewLimitStor(), map[string]ratelimit.Limit{"books": limit})
+	allow := func() time.Duration {
+		t.Helper()
+		wait, err := l.Allow(ctx, "books", "10.0.0.1")
+		if err != nil {
+			t.Fatalf("allow: %v", err)
+		}
+		return wait
+	}
+
+	for i := range 2 {
+		if wait := allow(); wait != 0 {
+			t.Fatalf("request %d of the burst waits %s", i+1, wait)
+		}
+	}
+	wait := allow()
+	if wait <= 0 || wait > 100*time.Millisecond {
+		t.Fatalf("empty bucket waits %s, want up to one token interval of 100ms", wait)
+	}
+	if other, err := l.Allow(ctx, "books", "10.0.0.2"); err != nil || other != 0 {
+		t.Fatalf("another key waits %s (%v), buckets are per key", other, err)
+	}
+	if unlimited, err := l.Allow(ctx, "admin", "10.0.0.1"); err != nil || unlimited != 0 {
+		t.Fatalf("group without a limit waits %s (%v)", unlimited, err)
+	}
+
+	time.Sleep(wait)
+	if again := allow(); again != 0 {
+		t.Fatalf("after the Retry-After wait the request still waits %s", again)
+	}
+	if again := allow(); again <= 0 {
+		t.Fatal("one refilled token served two requests")
+	}
+}
+
+func TestLockoutFailDoubles(t *testing.T) {
+	ctx := context.Background()
+	policy := ratelimit.LockoutPolicy{Threshold: 3, Base: time.Minute, Max: 4 * time.Minute, Window: time.Hour}
+	lockout := ratelimit.NewLockout(storage.NewLimitStor(), policy)
+	tests := []struct {
+		failure int
+		lock    time.Duration
+	}{
+		{failure: 1},
+		{failure: 2},
+		{failure: 3, lock: time.Minute},
+		{failure: 4, lock: 2 * time.Minute},
+		{failure: 5, lock: 4 * time.Minute},
+		{failure: 6, lock: 4 * time.Minute},
+		{failure: 10, lock: 4 * time.Minute},
+	}
+	failures := 0
+	for _, tt := range tests {
+		var err error
+		for failures < tt.failure {
+			err = lockout.Fail(ctx, "ann@example.com")
+			failures++
+		}
+		if tt.lock == 0 {
+			if err != nil {
+				t.Fatalf("failure %d: %v, want no lock", tt.failure, err)
+			}
+			continue
+		}
+		var locked *ratelimit.LockedError
+		if !errors.As(err, &locked) || !errors.Is(err, ratelimit.ErrLocked) {
+			t.Fatalf("failure %d: %v, want a LockedError", tt.failure, err)
+		}
+		if got := time.Until(locked.Until); got > tt.lock || got < tt.lock-time.Second {
+			t.Fatalf("failure %d locks for %s, want %s", tt.failure, got, tt.lock)
+		}
+		if err = lockout.Check(ctx, "ann@example.com"); !errors.Is(err, ratelimit.ErrLocked) {
+			t.Fatalf("failure %d: check %v, want locked", tt.failure, err)
+		}
+	}
+
+	if err := lockout.Reset(ctx, "ann@example.com"); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if err := lockout.Check(ctx, "ann@example.com"); err != nil {
+		t.Fatalf("check after reset: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package reqctx
+
+import "context"
+
+type ctxKey struct{}
+
+type Meta struct {
+	RequestID string
+	IP        string
+	UID       string
+	Admin     bool
+}
+
+func With(ctx context.Context, meta Meta) context.Context {
+	return context.WithValue(ctx, ctxKey{}, meta)
+}
+
+func WithUID(ctx context.Context, uid string) context.Context {
+	meta := From(ctx)
+	meta.UID = uid
+	return With(ctx, meta)
+}
+
+func WithUser(ctx context.Context, uid string, admin bool) context.Context {
+	meta := From(ctx)
+	meta.UID = uid
+	meta.Admin = admin
+	return With(ctx, meta)
+}
+
+func From(ctx context.Context) Meta {
+	meta, _ := ctx.Value(ctxKey{}).(Meta)
+	return meta
+}
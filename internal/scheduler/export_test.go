@@ -0,0 +1,8 @@
+package scheduler
+
+import "time"
+
+// SetPoll changes how often a running scheduler looks for requested runs.
+func (s *Scheduler) SetPoll(d time.Duration) {
+	s.poll = d
+}
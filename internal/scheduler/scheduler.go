@@ -0,0 +1,247 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+)
+
+var ErrUnknownJob = errors.New("unknown job")
+
+// triggerPoll is how often the running scheduler looks for runs requested
+// through the shared job state by other replicas.
+const triggerPoll = 2 * time.Second
+
+type StateStorage interface {
+	GetJobState(context.Context, string) (models.JobState, error)
+	// SaveJobState stores everything but TriggerRequestedAt, which only
+	// RequestRun and ClearRunRequest change.
+	SaveJobState(context.Context, models.JobState) error
+	// RequestRun sets TriggerRequestedAt unless a request is already pending.
+	RequestRun(ctx context.Context, name string, at time.Time) error
+	// ClearRunRequest drops a pending request made at or before upTo.
+	ClearRunRequest(ctx context.Context, name string, upTo time.Time) error
+}
+
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Retries  int
+	Backoff  time.Duration
+	Run      func(context.Context) (int, error)
+}
+
+type entry struct {
+	job      Job
+	trigger  chan struct{}
+	reset    chan struct{}
+	schedule atomic.Pointer[Schedule]
+	// requested is set when the last poll found a pending request.
+	requested atomic.Bool
+}
+
+func (e *entry) next(t time.Time) time.Time {
+	return (*e.schedule.Load()).Next(t)
+}
+
+type Scheduler struct {
+	stor    StateStorage
+	jobs    map[string]*entry
+	running atomic.Bool
+	poll    time.Duration
+}
+
+func New(stor StateStorage) *Scheduler {
+	return &Scheduler{
+		stor: stor,
+		jobs: make(map[string]*entry),
+		poll: triggerPoll,
+	}
+}
+
+func (s *Scheduler) Register(job Job) {
+	e := &entry{job: job, trigger: make(chan struct{}, 1), reset: make(chan struct{}, 1)}
+	e.schedule.Store(&job.Schedule)
+	s.jobs[job.Name] = e
+}
+
+// Reschedule replaces the job schedule, a waiting job recomputes its next run.
+func (s *Scheduler) Reschedule(name string, schedule Schedule) error {
+	e, ok := s.jobs[name]
+	if !ok {
+		return ErrUnknownJob
+	}
+	e.schedule.Store(&schedule)
+	select {
+	case e.reset <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *Scheduler) Run(ctx context.Context) error {
+	log := logger.Get()
+	defer log.Debug().Msg("scheduler stoped")
+	s.running.Store(true)
+	defer s.running.Store(false)
+	var wg sync.WaitGroup
+	for _, e := range s.jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, e)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func (s *Scheduler) Running() bool {
+	return s.running.Load()
+}
+
+// Trigger asks the job to run as soon as possible; repeated triggers before it starts are coalesced.
+// The request goes through the job state, so it reaches the leader from any replica.
+func (s *Scheduler) Trigger(ctx context.Context, name string) error {
+	e, ok := s.jobs[name]
+	if !ok {
+		return ErrUnknownJob
+	}
+	if err := s.stor.RequestRun(ctx, name, time.Now()); err != nil {
+		return err
+	}
+	// The leader would find the request on its next poll, when that is us
+	// start right away.
+	if s.Running() {
+		select {
+		case e.trigger <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Pending returns the number of queued triggers for the job, at most one since they coalesce.
+func (s *Scheduler) Pending(name string) int {
+	e, ok := s.jobs[name]
+	if !ok {
+		return 0
+	}
+	if e.requested.Load() {
+		return 1
+	}
+	return len(e.trigger)
+}
+
+func (s *Scheduler) State(ctx context.Context, name string) (models.JobState, error) {
+	if _, ok := s.jobs[name]; !ok {
+		return models.JobState{}, ErrUnknownJob
+	}
+	return s.stor.GetJobState(ctx, name)
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	log := logger.Get().With().Str("job", e.job.Name).Logger()
+	state, err := s.stor.GetJobState(ctx, e.job.Name)
+	if err != nil {
+		log.Error().Err(err).Msg("load job state failed")
+		state = models.JobState{Name: e.job.Name}
+	}
+	next := e.next(time.Now())
+	if state.NextRunAt != nil && state.NextRunAt.Before(next) {
+		next = *state.NextRunAt
+	}
+	poll := time.NewTicker(s.poll)
+	defer poll.Stop()
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-e.trigger:
+			timer.Stop()
+		case <-e.reset:
+			timer.Stop()
+			next = e.next(time.Now())
+			continue
+		case <-poll.C:
+			timer.Stop()
+			if !s.runRequested(ctx, e) {
+				continue
+			}
+		}
+		// Any run serves the requests made so far, later ones run it again.
+		if err = s.stor.ClearRunRequest(ctx, e.job.Name, time.Now()); err != nil {
+			log.Error().Err(err).Msg("clear job run request failed")
+		}
+		e.requested.Store(false)
+		select {
+		case <-e.trigger:
+		default:
+		}
+		state = s.execute(ctx, e.job, state)
+		next = e.next(time.Now())
+		state.NextRunAt = &next
+		if err = s.stor.SaveJobState(context.WithoutCancel(ctx), state); err != nil {
+			log.Error().Err(err).Msg("save job state failed")
+		}
+	}
+}
+
+func (s *Scheduler) runRequested(ctx context.Context, e *entry) bool {
+	state, err := s.stor.GetJobState(ctx, e.job.Name)
+	if err != nil {
+		log := logger.Get()
+		log.Error().Err(err).Str("job", e.job.Name).Msg("load job state failed")
+		return false
+	}
+	e.requested.Store(state.TriggerRequestedAt != nil)
+	return state.TriggerRequestedAt != nil
+}
+
+func (s *Scheduler) execute(ctx context.Context, job Job, state models.JobState) models.JobState {
+	log := logger.Get().With().Str("job", job.Name).Logger()
+	start := time.Now()
+	var affected int
+	var err error
+	for attempt := range job.Retries + 1 {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+			case <-time.After(job.Backoff << (attempt - 1)):
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		affected, err = job.Run(ctx)
+		if err == nil {
+			break
+		}
+		log.Warn().Err(err).Int("attempt", attempt+1).Msg("job run failed")
+	}
+	finished := time.Now()
+	state.LastRunAt = &start
+	state.LastDurationMS = finished.Sub(start).Milliseconds()
+	state.RunsTotal++
+	if err != nil {
+		log.Error().Err(err).Msg("job failed")
+		state.FailuresTotal++
+		state.LastError = err.Error()
+		return state
+	}
+	log.Debug().Int("affected", affected).Msg("job done")
+	state.LastSuccessAt = &finished
+	state.LastError = ``
+	state.LastResult = affected
+	state.AffectedTotal += int64(affected)
+	return state
+}
@@ -0,0 +1,266 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/scheduler"
+	"github.com/Dorrrke/gt4-bookly/internal/storage"
+)
+
+const jobName = "purge"
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2024, 5, 1, 10, 15, 0, 0, time.UTC)
+	tests := []struct {
+		spec    string
+		want    time.Time
+		wantErr bool
+	}{
+		{spec: "30m", want: from.Add(30 * time.Minute)},
+		{spec: "1h30m", want: from.Add(90 * time.Minute)},
+		{spec: "0 3 * * *", want: time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC)},
+		{spec: "*/20 * * * *", want: time.Date(2024, 5, 1, 10, 20, 0, 0, time.UTC)},
+		{spec: "0s", wantErr: true},
+		{spec: "-5m", wantErr: true},
+		{spec: "61 * * * *", wantErr: true},
+		{spec: "every day", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			sched, err := scheduler.ParseSchedule(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseSchedule(%q) accepted", tt.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q): %v", tt.spec, err)
+			}
+			if got := sched.Next(from); !got.Equal(tt.want) {
+				t.Fatalf("Next %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func mustSchedule(t *testing.T, spec string) scheduler.Schedule {
+	t.Helper()
+	sched, err := scheduler.ParseSchedule(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sched
+}
+
+// start runs s until the test ends and waits until it accepts triggers.
+func start(t *testing.T, s *scheduler.Scheduler) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	deadline := time.Now().Add(time.Second)
+	for !s.Running() {
+		if time.Now().After(deadline) {
+			t.Fatal("scheduler did not start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waitState(t *testing.T, s *scheduler.Scheduler, ok func(models.JobState) bool) models.JobState {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		state, err := s.State(context.Background(), jobName)
+		if err != nil {
+			t.Fatalf("state: %v", err)
+		}
+		if ok(state) {
+			return state
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job state %+v", state)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTriggerCoalesces(t *testing.T) {
+	var runs atomic.Int32
+	release := make(chan struct{})
+	s := scheduler.New(storage.NewJobStor())
+	s.Register(scheduler.Job{
+		Name:     jobName,
+		Schedule: mustSchedule(t, "1h"),
+		Run: func(context.Context) (int, error) {
+			if runs.Add(1) == 1 {
+				<-release
+			}
+			return 1, nil
+		},
+	})
+	if err := s.Trigger(context.Background(), "unknown"); !errors.Is(err, scheduler.ErrUnknownJob) {
+		t.Fatalf("trigger unknown job: %v", err)
+	}
+	start(t, s)
+
+	if err := s.Trigger(context.Background(), jobName); err != nil {
+		t.Fatalf("trigger: %v", err)
+	}
+	for runs.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// The first run is blocked, these collapse into one more run.
+	for range 3 {
+		if err := s.Trigger(context.Background(), jobName); err != nil {
+			t.Fatalf("trigger: %v", err)
+		}
+	}
+	if got := s.Pending(jobName); got != 1 {
+		t.Fatalf("pending %d, want 1", got)
+	}
+	close(release)
+
+	state := waitState(t, s, func(st models.JobState) bool { return st.RunsTotal == 2 })
+	time.Sleep(20 * time.Millisecond)
+	if got := runs.Load(); got != 2 {
+		t.Fatalf("job ran %d times, want 2", got)
+	}
+	if state.AffectedTotal != 2 || state.NextRunAt == nil {
+		t.Fatalf("state %+v", state)
+	}
+}
+
+func TestRetriesWithBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		retries  int
+		failures int32
+		wantErr  bool
+	}{
+		{name: "recovers", retries: 2, failures: 2},
+		{name: "gives up", retries: 1, failures: 5, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const backoff = 10 * time.Millisecond
+			var calls atomic.Int32
+			s := scheduler.New(storage.NewJobStor())
+			s.Register(scheduler.Job{
+				Name:     jobName,
+				Schedule: mustSchedule(t, "1h"),
+				Retries:  tt.retries,
+				Backoff:  backoff,
+				Run: func(context.Context) (int, error) {
+					if calls.Add(1) <= tt.failures {
+						return 0, errors.New("database is down")
+					}
+					return 3, nil
+				},
+			})
+			start(t, s)
+			began := time.Now()
+			if err := s.Trigger(context.Background(), jobName); err != nil {
+				t.Fatalf("trigger: %v", err)
+			}
+			state := waitState(t, s, func(st models.JobState) bool { return st.RunsTotal == 1 })
+
+			if got, want := calls.Load(), int32(tt.retries+1); got != want {
+				t.Fatalf("job called %d times, want %d", got, want)
+			}
+			// Backoff doubles: 10ms, 20ms, ...
+			if minWait := backoff * (1<<tt.retries - 1); time.Since(began) < minWait {
+				t.Fatalf("retries took %v, want at least %v", time.Since(began), minWait)
+			}
+			if tt.wantErr {
+				if state.FailuresTotal != 1 || state.LastError == "" || state.LastSuccessAt != nil {
+					t.Fatalf("state %+v, want a recorded failure", state)
+				}
+				return
+			}
+			if state.FailuresTotal != 0 || state.LastError != "" || state.LastResult != 3 {
+				t.Fatalf("state %+v, want a success", state)
+			}
+		})
+	}
+}
+
+// TestCatchUpPersistedNextRun covers a restart after a missed run: the
+// persisted next run is in the past, so the job runs right away instead of
+// a full interval later.
+func TestCatchUpPersistedNextRun(t *testing.T) {
+	stor := storage.NewJobStor()
+	missed := time.Now().Add(-time.Minute)
+	if err := stor.SaveJobState(context.Background(), models.JobState{Name: jobName, NextRunAt: &missed}); err != nil {
+		t.Fatal(err)
+	}
+	s := scheduler.New(stor)
+	s.Register(scheduler.Job{
+		Name:     jobName,
+		Schedule: mustSchedule(t, "1h"),
+		Run:      func(context.Context) (int, error) { return 0, nil },
+	})
+	start(t, s)
+
+	state := waitState(t, s, func(st models.JobState) bool { return st.RunsTotal == 1 })
+	if state.NextRunAt == nil || time.Until(*state.NextRunAt) < 59*time.Minute {
+		t.Fatalf("next run %v, want an hour from now", state.NextRunAt)
+	}
+}
+
+func TestIntervalRuns(t *testing.T) {
+	s := scheduler.New(storage.NewJobStor())
+	s.Register(scheduler.Job{
+		Name:     jobName,
+		Schedule: mustSchedule(t, "20ms"),
+		Run:      func(context.Context) (int, error) { return 0, nil },
+	})
+	start(t, s)
+	waitState(t, s, func(st models.JobState) bool { return st.RunsTotal >= 3 })
+}
+
+// TestTriggerFromFollower covers a manual trigger that reaches a replica
+// without the lease: it is stored and the leader runs the job.
+func TestTriggerFromFollower(t *testing.T) {
+	stor := storage.NewJobStor()
+	var runs atomic.Int32
+	job := scheduler.Job{
+		Name:     jobName,
+		Schedule: mustSchedule(t, "1h"),
+		Run: func(context.Context) (int, error) {
+			runs.Add(1)
+			return 0, nil
+		},
+	}
+	leader := scheduler.New(stor)
+	leader.SetPoll(10 * time.Millisecond)
+	leader.Register(job)
+	follower := scheduler.New(stor)
+	follower.Register(job)
+	start(t, leader)
+
+	if err := follower.Trigger(context.Background(), jobName); err != nil {
+		t.Fatalf("trigger on follower: %v", err)
+	}
+	state := waitState(t, leader, func(st models.JobState) bool { return st.RunsTotal == 1 })
+	if state.TriggerRequestedAt != nil {
+		t.Fatalf("request still pending after the run: %v", state.TriggerRequestedAt)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := runs.Load(); got != 1 {
+		t.Fatalf("job ran %d times, want 1", got)
+	}
+}
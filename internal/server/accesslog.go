@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxLoggedBody   = 4 << 10
+	jsonContentType = "application/json"
+)
+
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+func (s *BooklyAPI) AccessLogMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		var body []byte
+		if logger.DebugEnabled() {
+			body = peekBody(ctx.Request)
+		}
+		ctx.Next()
+
+		req := ctx.Request
+		log := logger.FromContext(req.Context())
+		status := ctx.Writer.Status()
+		evt := log.Info()
+		switch {
+		case status >= http.StatusInternalServerError:
+			evt = log.Error()
+		case status >= http.StatusBadRequest:
+			evt = log.Warn()
+		}
+		evt = evt.Str("path", req.URL.Path).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Int("size", ctx.Writer.Size()).
+			Str("ip", ctx.ClientIP()).
+			Str("user_agent", req.UserAgent())
+		if errs := ctx.Errors.ByType(gin.ErrorTypePrivate).String(); errs != "" {
+			evt = evt.Str("errors", errs)
+		}
+		if logger.DebugEnabled() {
+			evt = evt.Any("headers", redactHeaders(req.Header))
+			if len(body) > 0 {
+				evt = evt.RawJSON("body", body)
+			}
+		}
+		evt.Msg("request")
+	}
+}
+
+// RecoveryMiddleware replaces gin.Recovery so panics end up in the structured log.
+func (s *BooklyAPI) RecoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(ctx *gin.Context, recovered any) {
+		log := logger.FromContext(ctx.Request.Context())
+		log.Error().Any("panic", recovered).Bytes("stack", debug.Stack()).Msg("panic recovered")
+		abortWithError(ctx, fmt.Errorf("panic: %v", recovered))
+	})
+}
+
+func redactHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	for _, name := range sensitiveHeaders {
+		if out.Get(name) != "" {
+			out.Set(name, logger.Redacted)
+		}
+	}
+	return out
+}
+
+// peekBody returns a redacted copy of a JSON request body and puts the
+// original back for the handlers. Anything else is not logged.
+func peekBody(req *http.Request) []byte {
+	if req.Body == nil || !strings.HasPrefix(req.Header.Get("Content-Type"), jsonContentType) {
+		return nil
+	}
+	raw, err := io.ReadAll(io.LimitReader(req.Body, maxLoggedBody+1))
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(raw), req.Body), req.Body}
+	if err != nil || len(raw) > maxLoggedBody {
+		return nil
+	}
+	return logger.RedactJSON(raw)
+}
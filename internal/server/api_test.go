@@ -0,0 +1,471 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/config"
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/health"
+	"github.com/Dorrrke/gt4-bookly/internal/ratelimit"
+	"github.com/Dorrrke/gt4-bookly/internal/scheduler"
+	"github.com/Dorrrke/gt4-bookly/internal/server"
+	"github.com/Dorrrke/gt4-bookly/internal/service"
+	"github.com/Dorrrke/gt4-bookly/internal/storage"
+	"github.com/google/uuid"
+)
+
+const missingBook = "00000000-0000-0000-0000-000000000000"
+
+type api struct {
+	t       *testing.T
+	srv     *server.BooklyAPI
+	handler http.Handler
+}
+
+// newAPI serves the routes over empty in-memory storage.
+func newAPI(t *testing.T) *api {
+	t.Helper()
+	return newAPIWithUsers(t, storage.NewUserStor(nil), testConfig())
+}
+
+// testConfig is the default config with limits no test runs into.
+func testConfig() config.Config {
+	cfg := config.Default()
+	cfg.RateLimitAuth = "1000/1m"
+	cfg.RateLimitLogin = "1000/1m"
+	cfg.RateLimitBooks = "1000/1m"
+	return cfg
+}
+
+// newAdminAPI is newAPI with an admin account and returns the admin token.
+func newAdminAPI(t *testing.T) (*api, string) {
+	t.Helper()
+	const uid = "11111111-1111-1111-1111-111111111111"
+	users := storage.NewUserStor(nil)
+	admin := models.User{UID: uuid.MustParse(uid), Name: "Admin", Email: "admin@example.com", Passoword: "password1"}
+	if _, err := users.SaveUser(context.Background(), admin); err != nil {
+		t.Fatalf("save admin: %v", err)
+	}
+	cfg := testConfig()
+	cfg.Admins = []string{uid}
+	a := newAPIWithUsers(t, users, cfg)
+	rec := a.do(http.MethodPost, "/api/v2/users/login", "", map[string]any{"email": admin.Email, "pass": admin.Passoword})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("admin login: status %d, body %s", rec.Code, rec.Body)
+	}
+	return a, rec.Header().Get("Authorization")
+}
+
+func newAPIWithUsers(t *testing.T, users *storage.MapUserStorage, cfg config.Config) *api {
+	t.Helper()
+	cfg.Storage = config.StorageMemory
+
+	outbox := storage.NewOutbox()
+	limitStor := storage.NewLimitStor()
+	auditService := service.NewAuditService(storage.NewAuditStor())
+	userService := service.NewUserService(users, &auditService,
+		ratelimit.NewLockout(limitStor, ratelimit.LockoutPolicy{}))
+	bookService := service.NewBookService(storage.NewBookStor(outbox), &auditService)
+	webhookService := service.NewWebhookService(storage.NewWebhookStor())
+	schedule, err := scheduler.ParseSchedule(cfg.PurgeSchedule)
+	if err != nil {
+		t.Fatalf("purge schedule: %v", err)
+	}
+	sched := scheduler.New(storage.NewJobStor())
+	sched.Register(scheduler.Job{
+		Name:     service.PurgeJobName,
+		Schedule: schedule,
+		Run: func(ctx context.Context) (int, error) {
+			return bookService.PurgeDeleted(ctx, cfg.Retention)
+		},
+	})
+	srv, err := server.New(cfg, userService, bookService, webhookService, auditService,
+		sched, health.New(time.Second), limitStor)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+	return &api{t: t, srv: srv, handler: srv.Handler()}
+}
+
+func (a *api) do(method, target, token string, body any) *httptest.ResponseRecorder {
+	a.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			a.t.Fatalf("encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// register signs up a fresh user and returns their token.
+func (a *api) register(email string) string {
+	a.t.Helper()
+	rec := a.do(http.MethodPost, "/api/v2/users/register", "", userBody(email))
+	if rec.Code != http.StatusCreated {
+		a.t.Fatalf("register %s: status %d, body %s", email, rec.Code, rec.Body)
+	}
+	return rec.Header().Get("Authorization")
+}
+
+func userBody(email string) map[string]any {
+	return map[string]any{"email": email, "pass": "password1", "name": "Reader", "age": 30}
+}
+
+func bookBody() map[string]any {
+	return map[string]any{"title": "Dune", "author": "Frank Herbert", "description": "Spice", "published_at": "1965-08"}
+}
+
+// bookBodyV1 is bookBody with the field names of v1.
+func bookBodyV1() map[string]any {
+	return map[string]any{"lable": "Dune", "author": "Frank Herbert", "desc": "Spice", "writed_at": "1965-08"}
+}
+
+type problemBody struct {
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+	Errors []struct {
+		Field string `json:"field"`
+	} `json:"errors"`
+}
+
+func wantProblem(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) problemBody {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status %d, want %d, body %s", rec.Code, status, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("content type %q, want application/problem+json", ct)
+	}
+	var p problemBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	if p.Status != status || p.Code != code {
+		t.Fatalf("problem %d %q, want %d %q", p.Status, p.Code, status, code)
+	}
+	return p
+}
+
+func TestGetBooksEmpty(t *testing.T) {
+	a := newAPI(t)
+	rec := a.do(http.MethodGet, "/api/v2/books/", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+		t.Fatalf("body %s, want []", body)
+	}
+}
+
+func TestAddBookCreated(t *testing.T) {
+	a := newAPI(t)
+	token := a.register("owner@example.com")
+
+	rec := a.do(http.MethodPost, "/api/v2/books/", token, bookBody())
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d, want 201, body %s", rec.Code, rec.Body)
+	}
+	var created struct {
+		BID         string `json:"bid"`
+		Title       string `json:"title"`
+		PublishedAt string `json:"published_at"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode created book: %v", err)
+	}
+	if created.BID == "" || created.BID == missingBook || created.Title != "Dune" || created.PublishedAt != "1965-08" {
+		t.Fatalf("created book %+v", created)
+	}
+	location := rec.Header().Get("Location")
+	if location != "/api/v2/books/"+created.BID {
+		t.Fatalf("Location %q, want /api/v2/books/%s", location, created.BID)
+	}
+
+	got := a.do(http.MethodGet, location, "", nil)
+	if got.Code != http.StatusOK {
+		t.Fatalf("get created book: status %d", got.Code)
+	}
+	if !bytes.Equal(got.Body.Bytes(), rec.Body.Bytes()) {
+		t.Fatalf("get created book: body %s, want %s", got.Body, rec.Body)
+	}
+
+	list := a.do(http.MethodGet, "/api/v2/books/", "", nil)
+	var books []map[string]any
+	if err := json.Unmarshal(list.Body.Bytes(), &books); err != nil || len(books) != 1 {
+		t.Fatalf("list after add: %s (%v)", list.Body, err)
+	}
+}
+
+func TestBookNotFound(t *testing.T) {
+	a := newAPI(t)
+	token := a.register("owner@example.com")
+	tests := []struct {
+		name   string
+		method string
+	}{
+		{"get", http.MethodGet},
+		{"delete", http.MethodDelete},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := a.do(tt.method, "/api/v2/books/"+missingBook, token, nil)
+			wantProblem(t, rec, http.StatusNotFound, "book_not_found")
+		})
+	}
+}
+
+func TestUnknownRoute(t *testing.T) {
+	a := newAPI(t)
+	wantProblem(t, a.do(http.MethodGet, "/api/v2/authors/", "", nil), http.StatusNotFound, "not_found")
+	rec := a.do(http.MethodPatch, "/api/v2/books/", "", bookBody())
+	wantProblem(t, rec, http.StatusMethodNotAllowed, "method_not_allowed")
+	if allow := rec.Header().Get("Allow"); !strings.Contains(allow, http.MethodPost) {
+		t.Fatalf("Allow = %q, want it to list POST", allow)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	a := newAPI(t)
+	tests := []struct {
+		name string
+		id   string
+		keep bool
+	}{
+		{name: "uuid", id: "0b7c4f8e-3a1d-4c57-9a43-2f1f4b6e8d10", keep: true},
+		{name: "trace id", id: "00-4bf92f3577b34da6a3ce929d0e0e4736-01", keep: true},
+		{name: "empty", id: ""},
+		{name: "too long", id: strings.Repeat("a", 65)},
+		{name: "control chars", id: "abc\x1b[31m"},
+		{name: "spaces", id: "a b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+			req.Header.Set("X-Request-ID", tt.id)
+			rec := httptest.NewRecorder()
+			a.handler.ServeHTTP(rec, req)
+			got := rec.Header().Get("X-Request-ID")
+			if tt.keep {
+				if got != tt.id {
+					t.Fatalf("X-Request-ID = %q, want %q", got, tt.id)
+				}
+				return
+			}
+			if _, err := uuid.Parse(got); err != nil {
+				t.Fatalf("X-Request-ID = %q, want a fresh uuid", got)
+			}
+		})
+	}
+}
+
+func TestAddBookBadRequest(t *testing.T) {
+	a := newAPI(t)
+	token := a.register("owner@example.com")
+	badDate := bookBody()
+	badDate["published_at"] = "August 1965"
+	noTitle := bookBody()
+	delete(noTitle, "title")
+	tests := []struct {
+		name  string
+		body  any
+		code  string
+		field string
+	}{
+		{"bad date", badDate, "validation_failed", "published_at"},
+		{"missing field", noTitle, "validation_failed", "title"},
+		{"wrong type", map[string]any{"title": 1}, "invalid_body", "title"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := a.do(http.MethodPost, "/api/v2/books/", token, tt.body)
+			p := wantProblem(t, rec, http.StatusBadRequest, tt.code)
+			if len(p.Errors) != 1 || p.Errors[0].Field != tt.field {
+				t.Fatalf("field errors %+v, want one for %s", p.Errors, tt.field)
+			}
+		})
+	}
+}
+
+func TestAddBookUnauthorized(t *testing.T) {
+	a := newAPI(t)
+	rec := a.do(http.MethodPost, "/api/v2/books/", "", bookBody())
+	wantProblem(t, rec, http.StatusUnauthorized, "unauthorized")
+}
+
+func TestRegisterAndLoginReturnID(t *testing.T) {
+	a := newAPI(t)
+	var registered, loggedIn struct {
+		ID string `json:"id"`
+	}
+	rec := a.do(http.MethodPost, "/api/v2/users/register", "", userBody("reader@example.com"))
+	if err := json.Unmarshal(rec.Body.Bytes(), &registered); err != nil || rec.Code != http.StatusCreated {
+		t.Fatalf("register: status %d, body %s (%v)", rec.Code, rec.Body, err)
+	}
+	if _, err := uuid.Parse(registered.ID); err != nil || rec.Header().Get("Authorization") == "" {
+		t.Fatalf("register: id %q, Authorization %q", registered.ID, rec.Header().Get("Authorization"))
+	}
+	login := map[string]any{"email": "reader@example.com", "pass": "password1"}
+	rec = a.do(http.MethodPost, "/api/v2/users/login", "", login)
+	if err := json.Unmarshal(rec.Body.Bytes(), &loggedIn); err != nil || rec.Code != http.StatusCreated {
+		t.Fatalf("login: status %d, body %s (%v)", rec.Code, rec.Body, err)
+	}
+	if loggedIn.ID != registered.ID {
+		t.Fatalf("login id %q, want %q", loggedIn.ID, registered.ID)
+	}
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	a := newAPI(t)
+	a.register("twice@example.com")
+	rec := a.do(http.MethodPost, "/api/v2/users/register", "", userBody("twice@example.com"))
+	wantProblem(t, rec, http.StatusConflict, "user_exists")
+}
+
+func TestRegisterInvalid(t *testing.T) {
+	a := newAPI(t)
+	body := userBody("not-an-email")
+	rec := a.do(http.MethodPost, "/api/v2/users/register", "", body)
+	p := wantProblem(t, rec, http.StatusBadRequest, "validation_failed")
+	if len(p.Errors) != 1 || p.Errors[0].Field != "email" {
+		t.Fatalf("field errors %+v, want one for email", p.Errors)
+	}
+}
+
+func TestLoginInvalidCredentials(t *testing.T) {
+	a := newAPI(t)
+	a.register("reader@example.com")
+	tests := []struct {
+		name  string
+		email string
+		pass  string
+	}{
+		{"wrong password", "reader@example.com", "password2"},
+		{"unknown email", "nobody@example.com", "password1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := a.do(http.MethodPost, "/api/v2/users/login", "", map[string]any{"email": tt.email, "pass": tt.pass})
+			wantProblem(t, rec, http.StatusUnauthorized, "invalid_credentials")
+		})
+	}
+}
+
+func TestLoginRateLimited(t *testing.T) {
+	cfg := testConfig()
+	cfg.RateLimitLogin = config.Default().RateLimitLogin
+	a := newAPIWithUsers(t, storage.NewUserStor(nil), cfg)
+	a.register("reader@example.com")
+	login := map[string]any{"email": "reader@example.com", "pass": "password2"}
+	for i := range 5 {
+		rec := a.do(http.MethodPost, "/api/v2/users/login", "", login)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("login %d: status %d, want 401", i+1, rec.Code)
+		}
+	}
+
+	// The limit is per email, in any case.
+	login["email"] = "Reader@Example.com"
+	rec := a.do(http.MethodPost, "/api/v2/users/login", "", login)
+	wantProblem(t, rec, http.StatusTooManyRequests, "rate_limited")
+	retry, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	if err != nil || retry < 1 || retry > 12 {
+		t.Fatalf("Retry-After %q, want the seconds until the next token of 5/1m", rec.Header().Get("Retry-After"))
+	}
+
+	rec = a.do(http.MethodPost, "/api/v2/users/login", "", map[string]any{"email": "other@example.com", "pass": "x"})
+	if rec.Code == http.StatusTooManyRequests {
+		t.Fatal("another email is limited too")
+	}
+}
+
+func TestBookOwnerOnlyInTrash(t *testing.T) {
+	a := newAPI(t)
+	token := a.register("owner@example.com")
+	rec := a.do(http.MethodPost, "/api/v2/books/", token, bookBody())
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("add book: status %d", rec.Code)
+	}
+	location := rec.Header().Get("Location")
+
+	var books []map[string]any
+	list := a.do(http.MethodGet, "/api/v2/books/", "", nil)
+	if err := json.Unmarshal(list.Body.Bytes(), &books); err != nil || len(books) != 1 {
+		t.Fatalf("list: %s (%v)", list.Body, err)
+	}
+	if _, ok := books[0]["owner"]; ok {
+		t.Fatalf("public list shows the owner: %s", list.Body)
+	}
+
+	if rec = a.do(http.MethodDelete, location, token, nil); rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+		t.Fatalf("delete book: status %d, body %s", rec.Code, rec.Body)
+	}
+	trash := a.do(http.MethodGet, "/api/v2/books/trash", token, nil)
+	if err := json.Unmarshal(trash.Body.Bytes(), &books); err != nil || len(books) != 1 {
+		t.Fatalf("trash: %s (%v)", trash.Body, err)
+	}
+	if owner, _ := books[0]["owner"].(string); owner == "" {
+		t.Fatalf("trash does not show the owner: %s", trash.Body)
+	}
+
+	rec = a.do(http.MethodPost, location+"/restore", token, nil)
+	var restored map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &restored); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("restore: status %d, body %s (%v)", rec.Code, rec.Body, err)
+	}
+	if restored["bid"] != books[0]["bid"] || restored["title"] != "Dune" {
+		t.Fatalf("restored book %v", restored)
+	}
+	if _, ok := restored["deleted_at"]; ok {
+		t.Fatalf("restored book is still deleted: %v", restored)
+	}
+}
+
+func TestDeleteBookOwnerOnly(t *testing.T) {
+	a := newAPI(t)
+	owner := a.register("owner@example.com")
+	rec := a.do(http.MethodPost, "/api/v2/books/", owner, bookBody())
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("add book: status %d", rec.Code)
+	}
+	location := rec.Header().Get("Location")
+
+	other := a.register("other@example.com")
+	wantProblem(t, a.do(http.MethodDelete, location, other, nil), http.StatusForbidden, "forbidden")
+	if rec = a.do(http.MethodGet, location, "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("book after a forbidden delete: status %d", rec.Code)
+	}
+	if rec = a.do(http.MethodDelete, location, owner, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete by the owner: status %d", rec.Code)
+	}
+}
+
+// TestTriggerPurgeOnFollower runs against a scheduler that is not running,
+// as on a replica without the lease: the trigger is stored for the leader.
+func TestTriggerPurgeOnFollower(t *testing.T) {
+	a, token := newAdminAPI(t)
+	rec := a.do(http.MethodPost, "/api/v2/admin/purge", token, nil)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202, body %s", rec.Code, rec.Body)
+	}
+	rec = a.do(http.MethodGet, "/api/v2/admin/purge", token, nil)
+	var state models.JobState
+	if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil || state.TriggerRequestedAt == nil {
+		t.Fatalf("purge state %s (%v), want a pending request", rec.Body, err)
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *BooklyAPI) getAuditHandler(ctx *gin.Context) {
+	log := logger.FromContext(ctx.Request.Context())
+	filter := models.AuditFilter{
+		ActorUID: ctx.Query("actor"),
+		Action:   ctx.Query("action"),
+		Entity:   ctx.Query("entity"),
+		EntityID: ctx.Query("entity_id"),
+	}
+	var err error
+	if filter.From, err = parseTimeQuery(ctx, "from"); err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	if filter.To, err = parseTimeQuery(ctx, "to"); err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	if filter.Limit, err = parseIntQuery(ctx, "limit"); err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	if filter.Offset, err = parseIntQuery(ctx, "offset"); err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	entries, total, err := s.aService.GetEntries(ctx.Request.Context(), filter)
+	if err != nil {
+		log.Error().Err(err).Msg("get audit entries failed")
+		abortWithError(ctx, err)
+		return
+	}
+	if entries == nil {
+		entries = []models.AuditEntry{}
+	}
+	ctx.JSON(http.StatusOK, auditPage{Items: entries, Total: total, Offset: filter.Offset})
+}
+
+type auditPage struct {
+	Items  []models.AuditEntry `json:"items"`
+	Total  int                 `json:"total"`
+	Offset int                 `json:"offset"`
+}
+
+func parseTimeQuery(ctx *gin.Context, key string) (time.Time, error) {
+	val := ctx.Query(key)
+	if val == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return t, &inputError{field: key, msg: "must be an RFC 3339 time", err: err}
+	}
+	return t, nil
+}
+
+func parseIntQuery(ctx *gin.Context, key string) (int, error) {
+	val := ctx.Query(key)
+	if val == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return n, &inputError{field: key, msg: "must be an integer", err: err}
+	}
+	return n, nil
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Dorrrke/gt4-bookly/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exposedHeaders are response headers browsers may read cross-origin.
+var exposedHeaders = []string{"Authorization", "X-Request-Id", "Location", "Deprecation", "Sunset", "Link"}
+
+type corsPolicy struct {
+	origins     []string
+	methods     string
+	headers     string
+	credentials bool
+	maxAge      string
+}
+
+func newCORSPolicy(cfg config.Config) *corsPolicy {
+	return &corsPolicy{
+		origins:     cfg.CORSOrigins,
+		methods:     strings.Join(cfg.CORSMethods, ", "),
+		headers:     strings.Join(cfg.CORSHeaders, ", "),
+		credentials: cfg.CORSCredentials,
+		maxAge:      strconv.Itoa(int(cfg.CORSMaxAge.Seconds())),
+	}
+}
+
+func (p *corsPolicy) allowed(origin string) bool {
+	return slices.Contains(p.origins, "*") || slices.Contains(p.origins, origin)
+}
+
+// CORSMiddleware answers preflight requests and marks responses for the
+// configured origins. With no origins configured it does nothing.
+func (s *BooklyAPI) CORSMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cors := s.cors.Load()
+		origin := ctx.GetHeader("Origin")
+		if origin == "" || len(cors.origins) == 0 {
+			ctx.Next()
+			return
+		}
+		ctx.Writer.Header().Add("Vary", "Origin")
+		if !cors.allowed(origin) {
+			ctx.Next()
+			return
+		}
+		ctx.Header("Access-Control-Allow-Origin", origin)
+		if cors.credentials {
+			ctx.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if ctx.Request.Method == http.MethodOptions && ctx.GetHeader("Access-Control-Request-Method") != "" {
+			ctx.Header("Access-Control-Allow-Methods", cors.methods)
+			ctx.Header("Access-Control-Allow-Headers", cors.headers)
+			ctx.Header("Access-Control-Max-Age", cors.maxAge)
+			ctx.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		ctx.Header("Access-Control-Expose-Headers", strings.Join(exposedHeaders, ", "))
+		ctx.Next()
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const swaggerUIDist = "https://cdn.jsdelivr.net/npm/swagger-ui-dist@5.17.14"
+
+// The only files the page loads from the CDN. They have no integrity
+// attributes yet, so the policy allows these two and nothing else of the
+// package.
+const (
+	swaggerUIBundle = swaggerUIDist + "/swagger-ui-bundle.js"
+	swaggerUICSS    = swaggerUIDist + "/swagger-ui.css"
+)
+
+const swaggerInit = `SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});`
+
+const docsPage = `<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Bookly API</title>
+<link rel="stylesheet" href="` + swaggerUICSS + `" crossorigin="anonymous">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="` + swaggerUIBundle + `" crossorigin="anonymous"></script>
+<script>` + swaggerInit + `</script>
+</body>
+</html>
+`
+
+// docsCSP loosens the API-wide policy just enough for Swagger UI: its two
+// files from the CDN, the inline init script by hash and the spec from this
+// host.
+func docsCSP() string {
+	sum := sha256.Sum256([]byte(swaggerInit))
+	return "default-src 'none'; " +
+		"script-src " + swaggerUIBundle + " 'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'; " +
+		"style-src " + swaggerUICSS + "; " +
+		"img-src 'self' data:; " +
+		"connect-src 'self'; " +
+		"frame-ancestors 'none'"
+}
+
+func (s *BooklyAPI) docsHandler(ctx *gin.Context) {
+	ctx.Header("Content-Security-Policy", s.docsCSP)
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(docsPage))
+}
@@ -0,0 +1,15 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *BooklyAPI) Handler() http.Handler {
+	return s.configRouting()
+}
+
+func (s *BooklyAPI) Routes() gin.RoutesInfo {
+	return s.configRouting().Routes()
+}
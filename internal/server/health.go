@@ -0,0 +1,33 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Dorrrke/gt4-bookly/internal/health"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *BooklyAPI) healthzHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": health.StatusUp})
+}
+
+func (s *BooklyAPI) readyzHandler(ctx *gin.Context) {
+	report := s.health.Check(ctx.Request.Context())
+	code := http.StatusOK
+	if report.Status != health.StatusUp {
+		code = http.StatusServiceUnavailable
+	}
+	ctx.JSON(code, report)
+}
+
+var errDraining = errors.New("server is shutting down")
+
+func (s *BooklyAPI) drainCheck(context.Context) health.Component {
+	if s.draining.Load() {
+		return health.Down(errDraining, nil)
+	}
+	return health.Up(nil)
+}
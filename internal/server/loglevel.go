@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+type logLevelRequest struct {
+	Level string `json:"level" validate:"required,oneof=trace debug info warn error fatal panic disabled"`
+}
+
+func (s *BooklyAPI) getLogLevelHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"level": logger.Level()})
+}
+
+func (s *BooklyAPI) setLogLevelHandler(ctx *gin.Context) {
+	log := logger.FromContext(ctx.Request.Context())
+	var req logLevelRequest
+	if err := s.bindJSON(ctx, &req); err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	old := logger.Level()
+	if err := logger.SetLevel(req.Level); err != nil {
+		abortWithError(ctx, &inputError{field: "level", msg: "unknown log level", err: err})
+		return
+	}
+	log.Warn().
+		Str("from", old).
+		Str("to", req.Level).
+		Msg("log level changed")
+	ctx.JSON(http.StatusOK, gin.H{"level": logger.Level()})
+}
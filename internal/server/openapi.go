@@ -0,0 +1,343 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/health"
+	"github.com/Dorrrke/gt4-bookly/internal/openapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Placeholders for the book types, each API version fills in its own.
+type bookWire int
+
+const (
+	bookIn bookWire = iota
+	bookOne
+	bookList
+	bookTrash
+)
+
+// textBody documents a text/plain response.
+type textBody string
+
+const (
+	jwtScheme    = "jwt"
+	cookieScheme = "cookie"
+)
+
+type routeDoc struct {
+	method string
+	// path is in gin syntax, relative to the version root for API routes.
+	path    string
+	id      string
+	summary string
+	auth    bool
+	body    any
+	query   []openapi.Parameter
+	resp    []respDoc
+	// v1 replaces resp on v1 and the unversioned routes where they answer
+	// differently.
+	v1 []respDoc
+}
+
+type respDoc struct {
+	status int
+	desc   string
+	body   any
+	header string
+}
+
+var auditQuery = []openapi.Parameter{
+	queryParam("actor", "string", "", "actor uid"),
+	queryParam("action", "string", "", "e.g. book.deleted"),
+	queryParam("entity", "string", "", "e.g. book"),
+	queryParam("entity_id", "string", "", ""),
+	queryParam("from", "string", "date-time", "RFC 3339 time"),
+	queryParam("to", "string", "date-time", "RFC 3339 time"),
+	queryParam("limit", "integer", "", ""),
+	queryParam("offset", "integer", "", ""),
+}
+
+// rootDocs describe the routes outside the versioned API.
+var rootDocs = []routeDoc{
+	{method: http.MethodGet, path: "/", id: "hello", summary: "Greeting",
+		resp: []respDoc{{status: http.StatusOK, body: textBody("")}}},
+	{method: http.MethodGet, path: "/healthz", id: "healthz", summary: "Liveness probe",
+		resp: []respDoc{{status: http.StatusOK, body: health.Report{}}}},
+	{method: http.MethodGet, path: "/readyz", id: "readyz", summary: "Readiness probe",
+		resp: []respDoc{
+			{status: http.StatusOK, body: health.Report{}},
+			{status: http.StatusServiceUnavailable, desc: "Not ready", body: health.Report{}},
+		}},
+	{method: http.MethodGet, path: "/metrics", id: "metrics", summary: "Prometheus metrics",
+		resp: []respDoc{{status: http.StatusOK, body: textBody("")}}},
+	{method: http.MethodGet, path: "/openapi.json", id: "openapi", summary: "This document",
+		resp: []respDoc{{status: http.StatusOK, body: map[string]any{}}}},
+	{method: http.MethodGet, path: "/docs", id: "docs", summary: "Swagger UI",
+		resp: []respDoc{{status: http.StatusOK, desc: "HTML page"}}},
+}
+
+// apiDocs describe the routes mountAPI registers for every version.
+var apiDocs = []routeDoc{
+	{method: http.MethodPost, path: "/users/register", id: "registerUser", summary: "Register a user",
+		body: models.User{}, resp: []respDoc{
+			{status: http.StatusCreated, body: userCreated{}, header: "Authorization"},
+			{status: http.StatusBadRequest},
+			{status: http.StatusConflict},
+			{status: http.StatusTooManyRequests},
+		}, v1: []respDoc{
+			{status: http.StatusCreated, body: textBody(""), header: "Authorization"},
+			{status: http.StatusBadRequest},
+			{status: http.StatusUnauthorized, desc: "User already exists"},
+			{status: http.StatusTooManyRequests},
+		}},
+	{method: http.MethodPost, path: "/users/login", id: "loginUser", summary: "Log in",
+		body: models.UserLogin{}, resp: []respDoc{
+			{status: http.StatusCreated, body: userCreated{}, header: "Authorization"},
+			{status: http.StatusBadRequest},
+			{status: http.StatusUnauthorized},
+			{status: http.StatusTooManyRequests},
+		}, v1: []respDoc{
+			{status: http.StatusCreated, body: textBody(""), header: "Authorization"},
+			{status: http.StatusBadRequest},
+			{status: http.StatusUnauthorized},
+			{status: http.StatusTooManyRequests},
+		}},
+	{method: http.MethodPost, path: "/users/logout", id: "logoutUser", summary: "Drop the session cookies",
+		resp: []respDoc{{status: http.StatusNoContent}}},
+	{method: http.MethodGet, path: "/books/", id: "listBooks", summary: "List books",
+		resp: []respDoc{{status: http.StatusOK, body: bookList}},
+		v1:   []respDoc{{status: http.StatusOK, body: bookList}, {status: http.StatusNoContent, desc: "No books"}}},
+	{method: http.MethodPost, path: "/books/", id: "addBook", summary: "Add a book", auth: true,
+		body: bookIn, resp: []respDoc{
+			{status: http.StatusCreated, body: bookOne, header: "Location"},
+			{status: http.StatusBadRequest},
+			{status: http.StatusUnauthorized},
+			{status: http.StatusConflict},
+		}, v1: []respDoc{
+			{status: http.StatusCreated, body: textBody("")},
+			{status: http.StatusBadRequest},
+			{status: http.StatusUnauthorized},
+			{status: http.StatusConflict},
+		}},
+	{method: http.MethodGet, path: "/books/trash", id: "listTrash", summary: "List deleted books", auth: true,
+		resp: []respDoc{{status: http.StatusOK, body: bookTrash}, {status: http.StatusUnauthorized}}},
+	{method: http.MethodGet, path: "/books/:id", id: "getBook", summary: "Get a book",
+		resp: []respDoc{{status: http.StatusOK, body: bookOne}, {status: http.StatusNotFound}},
+		v1:   []respDoc{{status: http.StatusOK, body: bookOne}, {status: http.StatusNoContent, desc: "No such book"}}},
+	{method: http.MethodDelete, path: "/books/:id", id: "deleteBook", summary: "Move a book to the trash", auth: true,
+		resp: []respDoc{
+			{status: http.StatusNoContent},
+			{status: http.StatusUnauthorized},
+			{status: http.StatusForbidden},
+			{status: http.StatusNotFound},
+		}, v1: []respDoc{
+			{status: http.StatusOK, body: textBody("")},
+			{status: http.StatusNoContent, desc: "No such book"},
+			{status: http.StatusUnauthorized},
+			{status: http.StatusForbidden},
+		}},
+	{method: http.MethodPost, path: "/books/:id/restore", id: "restoreBook", summary: "Restore a book from the trash",
+		auth: true, resp: []respDoc{
+			{status: http.StatusOK, body: bookOne},
+			{status: http.StatusForbidden},
+			{status: http.StatusNotFound},
+		}, v1: []respDoc{
+			{status: http.StatusOK, body: textBody("")},
+			{status: http.StatusForbidden},
+			{status: http.StatusNotFound},
+		}},
+	{method: http.MethodPost, path: "/admin/webhooks", id: "addWebhook", summary: "Register a webhook", auth: true,
+		body: models.WebhookRequest{}, resp: []respDoc{
+			{status: http.StatusCreated, body: models.Webhook{}},
+			{status: http.StatusBadRequest},
+		}},
+	{method: http.MethodGet, path: "/admin/webhooks", id: "listWebhooks", summary: "List webhooks", auth: true,
+		resp: []respDoc{{status: http.StatusOK, body: []models.Webhook{}}}},
+	{method: http.MethodDelete, path: "/admin/webhooks/:id", id: "deleteWebhook", summary: "Delete a webhook",
+		auth: true, resp: []respDoc{{status: http.StatusNoContent}, {status: http.StatusNotFound}}},
+	{method: http.MethodGet, path: "/admin/webhooks/:id/deliveries", id: "listDeliveries",
+		summary: "List deliveries of a webhook", auth: true, resp: []respDoc{
+			{status: http.StatusOK, body: []models.WebhookDelivery{}},
+			{status: http.StatusNotFound},
+		}},
+	{method: http.MethodPost, path: "/admin/webhooks/deliveries/:id/replay", id: "replayDelivery",
+		summary: "Send a delivery again", auth: true, resp: []respDoc{
+			{status: http.StatusAccepted},
+			{status: http.StatusNotFound},
+		}},
+	{method: http.MethodGet, path: "/admin/audit", id: "listAudit", summary: "Search the audit log", auth: true,
+		query: auditQuery, resp: []respDoc{{status: http.StatusOK, body: auditPage{}}, {status: http.StatusBadRequest}}},
+	{method: http.MethodGet, path: "/admin/purge", id: "getPurge", summary: "Purge job state", auth: true,
+		resp: []respDoc{{status: http.StatusOK, body: models.JobState{}}}},
+	{method: http.MethodPost, path: "/admin/purge", id: "triggerPurge", summary: "Run the purge job now", auth: true,
+		resp: []respDoc{
+			{status: http.StatusAccepted, body: jobTriggered{}},
+			{status: http.StatusServiceUnavailable},
+		}},
+	{method: http.MethodGet, path: "/admin/log-level", id: "getLogLevel", summary: "Current log level", auth: true,
+		resp: []respDoc{{status: http.StatusOK, body: logLevelRequest{}}}},
+	{method: http.MethodPut, path: "/admin/log-level", id: "setLogLevel", summary: "Change the log level", auth: true,
+		body: logLevelRequest{}, resp: []respDoc{
+			{status: http.StatusOK, body: logLevelRequest{}},
+			{status: http.StatusBadRequest},
+		}},
+}
+
+func (s *BooklyAPI) openAPIHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, s.openAPI)
+}
+
+// buildOpenAPI documents rootDocs once and apiDocs for every API version.
+func buildOpenAPI(session sessionCookies) *openapi.Document {
+	reg := openapi.NewRegistry()
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:   "Bookly API",
+			Version: strings.TrimPrefix(apiV2, "/api/"),
+			Description: apiV1 + " and the unversioned routes are deprecated in favour of " + apiV2 + ". " +
+				"Errors are application/problem+json on " + apiV2 + " and {\"error\": ...} elsewhere.",
+		},
+		Paths: make(map[string]openapi.PathItem),
+		Components: openapi.Components{
+			SecuritySchemes: map[string]openapi.SecurityScheme{
+				jwtScheme: {
+					Type: "apiKey", In: "header", Name: "Authorization",
+					Description: "JWT from the Authorization header of register or login, sent as is.",
+				},
+			},
+		},
+	}
+	security := []map[string][]string{{jwtScheme: {}}}
+	if session.enabled {
+		doc.Components.SecuritySchemes[cookieScheme] = openapi.SecurityScheme{
+			Type: "apiKey", In: "cookie", Name: session.name,
+			Description: "Session cookie. Every state-changing request, login and register included, " +
+				"needs the X-CSRF-Token header, set to the " + session.csrfName + " cookie once there is a session.",
+		}
+		security = append(security, map[string][]string{cookieScheme: {}})
+	}
+
+	add := func(path, id string, rd routeDoc, v *apiVersion) {
+		answers := versionOf(path).resp
+		op := &openapi.Operation{
+			OperationID: id,
+			Summary:     rd.summary,
+			Parameters:  rd.query,
+			Responses:   make(map[string]openapi.Response),
+		}
+		if v != nil {
+			op.Tags = []string{v.name}
+			op.Deprecated = v.deprecated
+		}
+		if rd.auth {
+			op.Security = security
+		}
+		for _, name := range pathParams(path) {
+			op.Parameters = append(op.Parameters, openapi.Parameter{
+				Name: name, In: "path", Required: true, Schema: &openapi.Schema{Type: "string"},
+			})
+		}
+		if rd.body != nil {
+			op.RequestBody = &openapi.RequestBody{
+				Required: true,
+				Content:  jsonContent(reg.Schema(wireType(rd.body, v))),
+			}
+		}
+		for _, r := range answers.docs(rd) {
+			op.Responses[strconv.Itoa(r.status)] = response(reg, r, v, answers)
+		}
+		op.Responses["default"] = response(reg, respDoc{desc: "Error"}, v, answers)
+		item, ok := doc.Paths[openAPIPath(path)]
+		if !ok {
+			item = make(openapi.PathItem)
+			doc.Paths[openAPIPath(path)] = item
+		}
+		item[strings.ToLower(rd.method)] = op
+	}
+	for _, rd := range rootDocs {
+		add(rd.path, rd.id, rd, nil)
+	}
+	for i := range apiVersions {
+		v := &apiVersions[i]
+		doc.Tags = append(doc.Tags, openapi.Tag{Name: v.name, Description: "API mounted at " + v.root + "/"})
+		for _, rd := range apiDocs {
+			add(v.root+rd.path, v.name+strings.ToUpper(rd.id[:1])+rd.id[1:], rd, v)
+		}
+	}
+	doc.Components.Schemas = reg.Schemas()
+	return doc
+}
+
+func response(reg *openapi.Registry, r respDoc, v *apiVersion, answers responder) openapi.Response {
+	resp := openapi.Response{Description: r.desc}
+	if resp.Description == "" {
+		resp.Description = http.StatusText(r.status)
+	}
+	// Errors have the version's error body unless the route documents its
+	// own, like the health report /readyz answers with when it is down.
+	_, text := r.body.(textBody)
+	switch {
+	case text:
+		resp.Content = map[string]openapi.MediaType{"text/plain": {Schema: &openapi.Schema{Type: "string"}}}
+	case r.body != nil:
+		resp.Content = jsonContent(reg.Schema(wireType(r.body, v)))
+	case r.status >= http.StatusBadRequest || r.status == 0:
+		body, contentType := answers.errorBody()
+		resp.Content = map[string]openapi.MediaType{contentType: {Schema: reg.Schema(body)}}
+	}
+	if r.header != "" {
+		resp.Headers = map[string]openapi.Header{r.header: {Schema: &openapi.Schema{Type: "string"}}}
+	}
+	if r.status == http.StatusTooManyRequests {
+		resp.Headers = map[string]openapi.Header{"Retry-After": {
+			Description: "Seconds to wait before retrying",
+			Schema:      &openapi.Schema{Type: "integer"},
+		}}
+	}
+	return resp
+}
+
+// wireType resolves the book placeholders for version v.
+func wireType(body any, v *apiVersion) any {
+	w, ok := body.(bookWire)
+	if !ok || v == nil {
+		return body
+	}
+	return v.books.wire(w)
+}
+
+func jsonContent(schema *openapi.Schema) map[string]openapi.MediaType {
+	return map[string]openapi.MediaType{jsonContentType: {Schema: schema}}
+}
+
+func queryParam(name, typ, format, desc string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: desc, Schema: &openapi.Schema{Type: typ, Format: format}}
+}
+
+// openAPIPath turns gin's /books/:id into /books/{id}.
+func openAPIPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func pathParams(path string) []string {
+	var names []string
+	for _, part := range strings.Split(path, "/") {
+		if strings.HasPrefix(part, ":") {
+			names = append(names, part[1:])
+		}
+	}
+	return names
+}
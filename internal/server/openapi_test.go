@@ -0,0 +1,164 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type specDoc struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas         map[string]specSchema      `json:"schemas"`
+		SecuritySchemes map[string]json.RawMessage `json:"securitySchemes"`
+	} `json:"components"`
+}
+
+type specSchema struct {
+	Required   []string `json:"required"`
+	Properties map[string]struct {
+		Format    string   `json:"format"`
+		MinLength int      `json:"minLength"`
+		MinItems  int      `json:"minItems"`
+		Minimum   float64  `json:"minimum"`
+		Enum      []string `json:"enum"`
+		Items     *struct {
+			Enum []string `json:"enum"`
+		} `json:"items"`
+	} `json:"properties"`
+}
+
+func (a *api) spec() specDoc {
+	a.t.Helper()
+	rec := a.do(http.MethodGet, "/openapi.json", "", nil)
+	if rec.Code != http.StatusOK {
+		a.t.Fatalf("openapi.json: status %d", rec.Code)
+	}
+	var doc specDoc
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		a.t.Fatalf("decode openapi.json: %v", err)
+	}
+	return doc
+}
+
+// TestOpenAPICoversRoutes fails for a route registered without a spec entry.
+func TestOpenAPICoversRoutes(t *testing.T) {
+	a := newAPI(t)
+	doc := a.spec()
+	if doc.OpenAPI != "3.1.0" {
+		t.Fatalf("openapi %q, want 3.1.0", doc.OpenAPI)
+	}
+	for _, route := range a.srv.Routes() {
+		parts := strings.Split(route.Path, "/")
+		for i, part := range parts {
+			if strings.HasPrefix(part, ":") {
+				parts[i] = "{" + part[1:] + "}"
+			}
+		}
+		path := strings.Join(parts, "/")
+		if _, ok := doc.Paths[path][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("%s %s has no openapi entry", route.Method, path)
+		}
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	doc := newAPI(t).spec()
+	if _, ok := doc.Components.SecuritySchemes["jwt"]; !ok {
+		t.Fatal("jwt security scheme is missing")
+	}
+	schemas := []string{"User", "UserLogin", "Book", "BookRequest", "BookV2", "TrashedBookV2", "BookRequestV2", "Problem"}
+	for _, name := range schemas {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s is missing", name)
+		}
+	}
+
+	user := doc.Components.Schemas["User"]
+	if strings.Join(user.Required, ",") != "name,email,pass" {
+		t.Errorf("User required %v, want name, email and pass", user.Required)
+	}
+	if user.Properties["email"].Format != "email" {
+		t.Errorf("User.email format %q, want email", user.Properties["email"].Format)
+	}
+	if user.Properties["pass"].MinLength != 8 {
+		t.Errorf("User.pass minLength %d, want 8", user.Properties["pass"].MinLength)
+	}
+	if user.Properties["age"].Minimum != 14 {
+		t.Errorf("User.age minimum %v, want 14", user.Properties["age"].Minimum)
+	}
+
+	trashed := doc.Components.Schemas["TrashedBook"]
+	if _, ok := trashed.Properties["owner"]; !ok {
+		t.Errorf("TrashedBook has no owner: %v", trashed.Properties)
+	}
+	if _, ok := trashed.Properties["lable"]; !ok {
+		t.Errorf("TrashedBook does not promote the Book fields: %v", trashed.Properties)
+	}
+	if _, ok := doc.Components.Schemas["Book"].Properties["owner"]; ok {
+		t.Error("Book shows the owner")
+	}
+
+	hook := doc.Components.Schemas["WebhookRequest"]
+	events := hook.Properties["events"]
+	if events.MinItems != 1 || events.Items == nil || len(events.Items.Enum) == 0 {
+		t.Errorf("WebhookRequest.events %+v, want minItems 1 and an enum of events", events)
+	}
+}
+
+func TestOpenAPIResponses(t *testing.T) {
+	doc := newAPI(t).spec()
+	type response struct {
+		Headers map[string]json.RawMessage `json:"headers"`
+		Content map[string]json.RawMessage `json:"content"`
+	}
+	responses := func(path, method string) map[string]response {
+		t.Helper()
+		var op struct {
+			Responses map[string]response `json:"responses"`
+		}
+		if err := json.Unmarshal(doc.Paths[path][method], &op); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		return op.Responses
+	}
+
+	// The readiness report is sent as is, not as a problem.
+	down := responses("/readyz", "get")["503"]
+	if _, ok := down.Content["application/json"]; !ok || len(down.Content) != 1 {
+		t.Errorf("/readyz 503 content %v, want only application/json", down.Content)
+	}
+	if _, ok := responses("/api/v2/books/{id}", "get")["404"].Content["application/problem+json"]; !ok {
+		t.Error("book 404 is not documented as problem+json")
+	}
+	v1Book := responses("/api/v1/books/{id}", "get")
+	if _, ok := v1Book["204"]; !ok {
+		t.Error("v1 does not document a missing book as 204")
+	}
+	if _, ok := v1Book["default"].Content["application/json"]; !ok {
+		t.Error("v1 errors are not documented as {\"error\": ...}")
+	}
+	if _, ok := responses("/api/v2/users/login", "post")["429"].Headers["Retry-After"]; !ok {
+		t.Error("login 429 does not document Retry-After")
+	}
+}
+
+func TestDocsPage(t *testing.T) {
+	rec := newAPI(t).do(http.MethodGet, "/docs", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "/openapi.json") {
+		t.Fatal("docs page does not load /openapi.json")
+	}
+	csp := rec.Header().Get("Content-Security-Policy")
+	if !strings.Contains(csp, "script-src") || strings.Contains(csp, "unsafe-inline") {
+		t.Fatalf("docs CSP %q", csp)
+	}
+	// Only the pinned files, not the whole package.
+	if strings.Contains(csp, "swagger-ui-dist@5.17.14/ ") || strings.Contains(csp, "swagger-ui-dist@5.17.14/;") {
+		t.Fatalf("docs CSP %q allows the whole CDN package", csp)
+	}
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/Dorrrke/gt4-bookly/internal/ratelimit"
+	"github.com/Dorrrke/gt4-bookly/internal/server/utils"
+	"github.com/Dorrrke/gt4-bookly/internal/service"
+	"github.com/Dorrrke/gt4-bookly/internal/storage/storageerror"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+const problemContentType = "application/problem+json"
+
+// Error codes are part of the API, clients switch on them. Titles and
+// details are for humans and may change.
+const (
+	codeInvalidBody        = "invalid_body"
+	codeValidation         = "validation_failed"
+	codeUnauthorized       = "unauthorized"
+	codeInvalidToken       = "invalid_token"
+	codeInvalidCredentials = "invalid_credentials"
+	codeCSRF               = "csrf_mismatch"
+	codeForbidden          = "forbidden"
+	codeNotFound           = "not_found"
+	codeMethodNotAllowed   = "method_not_allowed"
+	codeBookNotFound       = "book_not_found"
+	codeBookExists         = "book_exists"
+	codeUserExists         = "user_exists"
+	codeWebhookNotFound    = "webhook_not_found"
+	codeDeliveryNotFound   = "delivery_not_found"
+	codeRateLimited        = "rate_limited"
+	codeLoginLocked        = "login_locked"
+	codeInternal           = "internal"
+)
+
+var (
+	errTokenMissing  = errors.New("token is empty")
+	errCSRFMismatch  = errors.New("csrf token mismatch")
+	errAdminRequired = errors.New("admin access required")
+	errRateLimited   = errors.New("too many requests")
+	errNoRoute       = errors.New("no such route")
+	errNoMethod      = errors.New("method not allowed")
+)
+
+// problem is an RFC 7807 error body.
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []fieldError `json:"errors,omitempty"`
+}
+
+type fieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type knownError struct {
+	err    error
+	status int
+	code   string
+	title  string
+}
+
+// knownErrors are the errors whose message is safe to show. Anything not
+// listed here is answered with a generic 500.
+var knownErrors = []knownError{
+	{storageerror.ErrBookNoFound, http.StatusNotFound, codeBookNotFound, "Book not found"},
+	{storageerror.ErrBookAlredyExist, http.StatusConflict, codeBookExists, "Book already exists"},
+	{storageerror.ErrUserAlredyExist, http.StatusConflict, codeUserExists, "User already exists"},
+	// Both look the same so login can't be used to probe for emails.
+	{storageerror.ErrInvalidPassword, http.StatusUnauthorized, codeInvalidCredentials, "Invalid email or password"},
+	{storageerror.ErrUserNoExist, http.StatusUnauthorized, codeInvalidCredentials, "Invalid email or password"},
+	{storageerror.ErrWebhookNotFound, http.StatusNotFound, codeWebhookNotFound, "Webhook not found"},
+	{storageerror.ErrDeliveryNotFound, http.StatusNotFound, codeDeliveryNotFound, "Webhook delivery not found"},
+	{service.ErrForbidden, http.StatusForbidden, codeForbidden, "Access to the book is forbidden"},
+	{ratelimit.ErrLocked, http.StatusTooManyRequests, codeLoginLocked, "Too many failed logins, try again later"},
+	{utils.ErrInvalidToken, http.StatusUnauthorized, codeInvalidToken, "Invalid token"},
+	{errTokenMissing, http.StatusUnauthorized, codeUnauthorized, "Authorization required"},
+	{errCSRFMismatch, http.StatusForbidden, codeCSRF, "CSRF token mismatch"},
+	{errAdminRequired, http.StatusForbidden, codeForbidden, "Admin access required"},
+	{errRateLimited, http.StatusTooManyRequests, codeRateLimited, "Too many requests"},
+	{errNoRoute, http.StatusNotFound, codeNotFound, "Not found"},
+	{errNoMethod, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed"},
+}
+
+// bodyError is a request body that could not be decoded.
+type bodyError struct {
+	err error
+}
+
+func (e *bodyError) Error() string { return "decode body: " + e.err.Error() }
+func (e *bodyError) Unwrap() error { return e.err }
+
+// inputError is a single request field or query parameter that could not
+// be parsed.
+type inputError struct {
+	field string
+	msg   string
+	err   error
+}
+
+func (e *inputError) Error() string { return e.field + ": " + e.err.Error() }
+func (e *inputError) Unwrap() error { return e.err }
+
+// bindJSON decodes the request body into v and validates it.
+func (s *BooklyAPI) bindJSON(ctx *gin.Context, v any) error {
+	if err := ctx.ShouldBindBodyWithJSON(v); err != nil {
+		return &bodyError{err: err}
+	}
+	return s.valid.Struct(v)
+}
+
+// abortWithError answers with the error err maps to, in the shape of the API
+// version the request is for. The full error is attached to the context, so
+// the access log shows it next to the request id while the client only sees
+// the mapped error.
+func abortWithError(ctx *gin.Context, err error) {
+	versionOf(ctx.Request.URL.Path).resp.fail(ctx, err)
+}
+
+func problemFor(err error) problem {
+	var (
+		valErrs  validator.ValidationErrors
+		bodyErr  *bodyError
+		inputErr *inputError
+	)
+	switch {
+	case errors.As(err, &valErrs):
+		p := newProblem(http.StatusBadRequest, codeValidation, "Validation failed")
+		p.Detail = "one or more fields are invalid"
+		for _, fe := range valErrs {
+			p.Errors = append(p.Errors, fieldError{Field: fieldPath(fe), Rule: fe.Tag(), Message: ruleMessage(fe)})
+		}
+		return p
+	case errors.As(err, &inputErr):
+		p := newProblem(http.StatusBadRequest, codeValidation, "Validation failed")
+		p.Detail = "one or more fields are invalid"
+		p.Errors = []fieldError{{Field: inputErr.field, Rule: "format", Message: inputErr.msg}}
+		return p
+	case errors.As(err, &bodyErr):
+		return bodyProblem(bodyErr.err)
+	}
+	for _, known := range knownErrors {
+		if errors.Is(err, known.err) {
+			return newProblem(known.status, known.code, known.title)
+		}
+	}
+	p := newProblem(http.StatusInternalServerError, codeInternal, "Internal server error")
+	p.Detail = "the request could not be completed, quote the request id when reporting it"
+	return p
+}
+
+func newProblem(status int, code, title string) problem {
+	return problem{
+		Type:   "urn:bookly:problem:" + code,
+		Title:  title,
+		Status: status,
+		Code:   code,
+	}
+}
+
+func bodyProblem(err error) problem {
+	p := newProblem(http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.Is(err, io.EOF):
+		p.Detail = "request body is empty"
+	case errors.As(err, &syntaxErr):
+		p.Detail = fmt.Sprintf("malformed json at offset %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		p.Detail = "a field has the wrong type"
+		p.Errors = []fieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: "must be " + jsonType(typeErr.Type),
+		}}
+	default:
+		p.Detail = "request body is not valid json"
+	}
+	return p
+}
+
+// fieldPath drops the struct name from the validator namespace, the rest
+// are json names thanks to jsonTagName.
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.IndexByte(ns, '.'); i >= 0 {
+		return ns[i+1:]
+	}
+	return ns
+}
+
+func ruleMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "url":
+		return "must be a valid url"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "min":
+		switch fe.Kind() { //nolint:exhaustive // other kinds are compared by value
+		case reflect.String:
+			return "must be at least " + fe.Param() + " characters long"
+		case reflect.Slice, reflect.Map:
+			return "must have at least " + fe.Param() + " items"
+		default:
+			return "must be at least " + fe.Param()
+		}
+	}
+	return "failed the " + fe.Tag() + " rule"
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() { //nolint:exhaustive // the rest are objects
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// jsonTagName makes validation errors name fields the way clients send them.
+func jsonTagName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+type problemRender struct {
+	p problem
+}
+
+func (r problemRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return json.NewEncoder(w).Encode(r.p)
+}
+
+func (r problemRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", problemContentType)
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/Dorrrke/gt4-bookly/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *BooklyAPI) getPurgeHandler(ctx *gin.Context) {
+	log := logger.FromContext(ctx.Request.Context())
+	state, err := s.scheduler.State(ctx.Request.Context(), service.PurgeJobName)
+	if err != nil {
+		log.Error().Err(err).Msg("get purge job state failed")
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, state)
+}
+
+func (s *BooklyAPI) purgeHandler(ctx *gin.Context) {
+	log := logger.FromContext(ctx.Request.Context())
+	if err := s.scheduler.Trigger(ctx.Request.Context(), service.PurgeJobName); err != nil {
+		log.Error().Err(err).Msg("trigger purge job failed")
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusAccepted, jobTriggered{Job: service.PurgeJobName, Status: "triggered"})
+}
+
+type jobTriggered struct {
+	Job    string `json:"job"`
+	Status string `json:"status"`
+}
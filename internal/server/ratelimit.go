@@ -0,0 +1,92 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/config"
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/Dorrrke/gt4-bookly/internal/metrics"
+	"github.com/Dorrrke/gt4-bookly/internal/ratelimit"
+	"github.com/Dorrrke/gt4-bookly/internal/reqctx"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rate limit groups, each has its own limit in the config.
+const (
+	limitAuth  = "auth"
+	limitLogin = "login"
+	limitBooks = "books"
+	limitAdmin = "admin"
+)
+
+// rateLimits maps the groups to their limits. The config is validated before
+// it gets here, so parse errors cannot happen.
+func rateLimits(cfg config.Config) map[string]ratelimit.Limit {
+	limits := make(map[string]ratelimit.Limit, 4)
+	for group, spec := range map[string]string{
+		limitAuth:  cfg.RateLimitAuth,
+		limitLogin: cfg.RateLimitLogin,
+		limitBooks: cfg.RateLimitBooks,
+		limitAdmin: cfg.RateLimitAdmin,
+	} {
+		limits[group], _ = ratelimit.ParseLimit(spec)
+	}
+	return limits
+}
+
+type limitKey func(*gin.Context) string
+
+func byIP(ctx *gin.Context) string {
+	return ctx.ClientIP()
+}
+
+// byUser keys on the uid set by JWTAuthMiddleware.
+func byUser(ctx *gin.Context) string {
+	return reqctx.From(ctx.Request.Context()).UID
+}
+
+// byEmail keys on the email in a JSON body. The body stays cached in the
+// context for the handler.
+func byEmail(ctx *gin.Context) string {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := ctx.ShouldBindBodyWithJSON(&body); err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(body.Email))
+}
+
+// RateLimitMiddleware rejects requests with 429 once the group limit for the
+// key is used up. Requests without a key and limiter errors are let through.
+func (s *BooklyAPI) RateLimitMiddleware(group string, key limitKey) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		k := key(ctx)
+		if k == "" {
+			ctx.Next()
+			return
+		}
+		wait, err := s.limiter.Allow(ctx.Request.Context(), group, k)
+		if err != nil {
+			log := logger.FromContext(ctx.Request.Context())
+			log.Error().Err(err).Str("group", group).Msg("rate limiter failed")
+			ctx.Next()
+			return
+		}
+		if wait > 0 {
+			metrics.RateLimited.WithLabelValues(group).Inc()
+			tooManyRequests(ctx, wait, errRateLimited)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func tooManyRequests(ctx *gin.Context, wait time.Duration, err error) {
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	abortWithError(ctx, err)
+}
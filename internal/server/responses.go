@@ -0,0 +1,163 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/reqctx"
+	"github.com/Dorrrke/gt4-bookly/internal/storage/storageerror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responder is how an API version answers. v2 has the REST status codes and
+// problem+json errors, v1 and the unversioned routes keep what they answered
+// before v2 existed, their clients were written against it.
+type responder interface {
+	// fail aborts the request with the error err maps to.
+	fail(ctx *gin.Context, err error)
+	bookAdded(ctx *gin.Context, books bookAdapter, book models.Book)
+	bookList(ctx *gin.Context, books bookAdapter, list []models.Book)
+	bookDeleted(ctx *gin.Context, bid string)
+	bookRestored(ctx *gin.Context, books bookAdapter, book models.Book)
+	// loggedIn and registered confirm a user the token was issued for.
+	loggedIn(ctx *gin.Context, uid string)
+	registered(ctx *gin.Context, uid string)
+	// docs returns the responses rd documents for this version.
+	docs(rd routeDoc) []respDoc
+	// errorBody returns a zero value of the error body and its content
+	// type, for the OpenAPI document.
+	errorBody() (any, string)
+}
+
+// v2Responses answer errors with problem+json and successes with JSON or
+// no body at all.
+type v2Responses struct{}
+
+func (v2Responses) fail(ctx *gin.Context, err error) {
+	_ = ctx.Error(err)
+	p := problemFor(err)
+	p.Instance = ctx.Request.URL.Path
+	p.RequestID = reqctx.From(ctx.Request.Context()).RequestID
+	ctx.Abort()
+	ctx.Render(p.Status, problemRender{p})
+}
+
+func (v2Responses) bookAdded(ctx *gin.Context, books bookAdapter, book models.Book) {
+	ctx.Header("Location", path.Join(ctx.Request.URL.Path, book.BID.String()))
+	ctx.JSON(http.StatusCreated, books.one(book))
+}
+
+func (v2Responses) bookList(ctx *gin.Context, books bookAdapter, list []models.Book) {
+	ctx.JSON(http.StatusOK, books.list(list))
+}
+
+func (v2Responses) bookDeleted(ctx *gin.Context, _ string) {
+	ctx.Status(http.StatusNoContent)
+}
+
+func (v2Responses) bookRestored(ctx *gin.Context, books bookAdapter, book models.Book) {
+	ctx.JSON(http.StatusOK, books.one(book))
+}
+
+func (v2Responses) loggedIn(ctx *gin.Context, uid string) {
+	ctx.JSON(http.StatusCreated, userCreated{ID: uid})
+}
+
+func (v2Responses) registered(ctx *gin.Context, uid string) {
+	ctx.JSON(http.StatusCreated, userCreated{ID: uid})
+}
+
+func (v2Responses) docs(rd routeDoc) []respDoc { return rd.resp }
+
+func (v2Responses) errorBody() (any, string) { return problem{}, problemContentType }
+
+// userCreated is what v2 answers register and login with, the token is in
+// the Authorization header.
+type userCreated struct {
+	ID string `json:"id"`
+}
+
+// legacyError is the error body of v1 and the unversioned routes.
+type legacyError struct {
+	Error string `json:"error"`
+}
+
+// v1Responses answer errors with {"error": message} and the status v2 has
+// for them, except where v1 had its own. A missing book or an empty list is
+// 204 without a body and changes are confirmed with a text message.
+type v1Responses struct{}
+
+func (v1Responses) fail(ctx *gin.Context, err error) {
+	_ = ctx.Error(err)
+	status := problemFor(err).Status
+	msg := err.Error()
+	switch {
+	case errors.Is(err, storageerror.ErrBookNoFound) && ctx.Request.Method != http.MethodPost:
+		// Reading or deleting a missing book was 204, only restore said 404.
+		ctx.AbortWithStatus(http.StatusNoContent)
+		return
+	case errors.Is(err, storageerror.ErrUserAlredyExist):
+		// Register answered every failure past validation with 401.
+		status = http.StatusUnauthorized
+	case status == http.StatusInternalServerError:
+		msg = strings.ToLower(http.StatusText(status))
+	}
+	ctx.AbortWithStatusJSON(status, legacyError{Error: msg})
+}
+
+func (v1Responses) bookAdded(ctx *gin.Context, _ bookAdapter, book models.Book) {
+	ctx.String(http.StatusCreated, "Book %s was saved", book.BID)
+}
+
+func (v1Responses) bookList(ctx *gin.Context, books bookAdapter, list []models.Book) {
+	if len(list) == 0 {
+		ctx.Status(http.StatusNoContent)
+		return
+	}
+	ctx.JSON(http.StatusOK, books.list(list))
+}
+
+func (v1Responses) bookDeleted(ctx *gin.Context, bid string) {
+	ctx.String(http.StatusOK, "Book %s was deleted", bid)
+}
+
+func (v1Responses) bookRestored(ctx *gin.Context, _ bookAdapter, book models.Book) {
+	ctx.String(http.StatusOK, "Book %s was restored", book.BID)
+}
+
+func (v1Responses) loggedIn(ctx *gin.Context, uid string) {
+	ctx.String(http.StatusCreated, "User was logined; user id: %s", uid)
+}
+
+func (v1Responses) registered(ctx *gin.Context, uid string) {
+	ctx.String(http.StatusCreated, "User was created; user id: %s", uid)
+}
+
+func (v1Responses) docs(rd routeDoc) []respDoc {
+	if rd.v1 != nil {
+		return rd.v1
+	}
+	return rd.resp
+}
+
+func (v1Responses) errorBody() (any, string) { return legacyError{}, jsonContentType }
+
+// versionOf returns the API version urlPath is under. Everything outside the
+// versioned roots belongs to the unversioned routes.
+func versionOf(urlPath string) *apiVersion {
+	var match *apiVersion
+	for i := range apiVersions {
+		v := &apiVersions[i]
+		if urlPath != v.root && !strings.HasPrefix(urlPath, v.root+"/") {
+			continue
+		}
+		if match == nil || len(v.root) > len(match.root) {
+			match = v
+		}
+	}
+	return match
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/Dorrrke/gt4-bookly/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+type securityHeaders struct {
+	hsts string
+	csp  string
+}
+
+func newSecurityHeaders(cfg config.Config) securityHeaders {
+	h := securityHeaders{csp: cfg.CSP}
+	if cfg.HSTSMaxAge > 0 && (cfg.TLSCert != "" || cfg.HSTSForce) {
+		h.hsts = "max-age=" + strconv.Itoa(int(cfg.HSTSMaxAge.Seconds())) + "; includeSubDomains"
+	}
+	return h
+}
+
+// SecurityHeadersMiddleware sets the headers browsers need to treat API
+// responses as data only. Routes serving HTML may override the CSP.
+func (s *BooklyAPI) SecurityHeadersMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		h := ctx.Writer.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "no-referrer")
+		if s.security.csp != "" {
+			h.Set("Content-Security-Policy", s.security.csp)
+		}
+		if s.security.hsts != "" {
+			h.Set("Strict-Transport-Security", s.security.hsts)
+		}
+		ctx.Next()
+	}
+}
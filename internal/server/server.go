@@ -5,97 +5,353 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/Dorrrke/gt4-bookly/internal/config"
+	"github.com/Dorrrke/gt4-bookly/internal/health"
 	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/Dorrrke/gt4-bookly/internal/metrics"
+	"github.com/Dorrrke/gt4-bookly/internal/openapi"
+	"github.com/Dorrrke/gt4-bookly/internal/ratelimit"
+	"github.com/Dorrrke/gt4-bookly/internal/reqctx"
+	"github.com/Dorrrke/gt4-bookly/internal/scheduler"
 	"github.com/Dorrrke/gt4-bookly/internal/server/utils"
 	"github.com/Dorrrke/gt4-bookly/internal/service"
+	"github.com/Dorrrke/gt4-bookly/internal/tracing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 type BooklyAPI struct {
-	serve    *http.Server
-	valid    *validator.Validate
-	uService service.UserService
-	bService service.BookService
-	delChan  chan struct{}
-	ErrChan  chan error
+	serve     *http.Server
+	valid     *validator.Validate
+	uService  service.UserService
+	bService  service.BookService
+	wService  service.WebhookService
+	aService  service.AuditService
+	admins    map[string]struct{}
+	scheduler *scheduler.Scheduler
+	health    *health.Checker
+	cors      atomic.Pointer[corsPolicy]
+	h2c       bool
+	drain     time.Duration
+	draining  atomic.Bool
+	limiter   *ratelimit.Limiter
+	proxies   []string
+	session   sessionCookies
+	security  securityHeaders
+	// v1Deprecation is announced on /api/v1 and the unversioned routes.
+	v1Deprecation deprecation
+	openAPI       *openapi.Document
+	docsCSP       string
 }
 
-func New(cfg config.Config, us service.UserService, bs service.BookService) *BooklyAPI {
+func New(
+	cfg config.Config,
+	us service.UserService,
+	bs service.BookService,
+	ws service.WebhookService,
+	as service.AuditService,
+	sched *scheduler.Scheduler,
+	checker *health.Checker,
+	limitStor ratelimit.Storage,
+) (*BooklyAPI, error) {
+	if !cfg.Debug {
+		gin.SetMode(gin.ReleaseMode)
+	}
 	addrStr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
-	server := http.Server{ //nolint:gosec //todo
-		Addr: addrStr,
+	server := http.Server{
+		Addr:              addrStr,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	if cfg.TLSCert != "" {
+		tlsCfg, err := tlsConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		server.TLSConfig = tlsCfg
 	}
+	v1Deprecation, err := newV1Deprecation(cfg)
+	if err != nil {
+		return nil, err
+	}
+	utils.SetupJWT(cfg.JWTSecret.Value(), cfg.JWTTTL, verifyKeys(cfg)...)
 	vald := validator.New()
+	vald.RegisterTagNameFunc(jsonTagName)
+	admins := make(map[string]struct{}, len(cfg.Admins))
+	for _, uid := range cfg.Admins {
+		if uid == "" {
+			continue
+		}
+		admins[uid] = struct{}{}
+	}
 	srv := BooklyAPI{
-		serve:    &server,
-		valid:    vald,
-		uService: us,
-		bService: bs,
-		delChan:  make(chan struct{}, 10),
-		ErrChan:  make(chan error, 10),
-	}
-	return &srv
+		serve:     &server,
+		valid:     vald,
+		uService:  us,
+		bService:  bs,
+		wService:  ws,
+		aService:  as,
+		admins:    admins,
+		scheduler: sched,
+		health:    checker,
+		h2c:       cfg.H2C,
+		drain:     cfg.DrainPeriod,
+		limiter:   ratelimit.NewLimiter(limitStor, rateLimits(cfg)),
+		proxies:   cfg.TrustedProxies,
+		session:   newSessionCookies(cfg),
+		security:  newSecurityHeaders(cfg),
+
+		v1Deprecation: v1Deprecation,
+		openAPI:       buildOpenAPI(newSessionCookies(cfg)),
+		docsCSP:       docsCSP(),
+	}
+	srv.cors.Store(newCORSPolicy(cfg))
+	checker.Register("http", srv.drainCheck)
+	return &srv, nil
+}
+
+// Reload applies the runtime changeable settings of cfg to a running server.
+func (s *BooklyAPI) Reload(cfg config.Config) {
+	s.cors.Store(newCORSPolicy(cfg))
+	s.limiter.SetLimits(rateLimits(cfg))
+	utils.SetJWTKeys(cfg.JWTSecret.Value(), verifyKeys(cfg)...)
+}
+
+func verifyKeys(cfg config.Config) []string {
+	verify := make([]string, 0, len(cfg.JWTVerifySecrets))
+	for _, secret := range cfg.JWTVerifySecrets {
+		verify = append(verify, secret.Value())
+	}
+	return verify
 }
 
-func (s *BooklyAPI) Run(ctx context.Context) error {
+func (s *BooklyAPI) Run(_ context.Context) error {
 	log := logger.Get()
-	router := s.configRouting()
-	s.serve.Handler = router
-	go s.deleter(ctx)
-	log.Info().Str("addr", s.serve.Addr).Msg("server start")
-	if err := s.serve.ListenAndServe(); err != nil {
+	var handler http.Handler = s.configRouting()
+	if s.h2c {
+		handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: s.serve.IdleTimeout})
+	}
+	s.serve.Handler = handler
+	var err error
+	if s.serve.TLSConfig != nil {
+		log.Info().Str("addr", s.serve.Addr).Msg("server start, https")
+		err = s.serve.ListenAndServeTLS("", "")
+	} else {
+		log.Info().Str("addr", s.serve.Addr).Bool("h2c", s.h2c).Msg("server start")
+		err = s.serve.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Error().Err(err).Msg("runing server failed")
 		return err
 	}
 	return nil
 }
 
+// Shutdown fails readiness for the drain period so load balancers stop
+// sending traffic, then closes the listener and waits for in-flight requests.
 func (s *BooklyAPI) Shutdown(ctx context.Context) error {
+	log := logger.Get()
+	s.draining.Store(true)
+	if s.drain > 0 {
+		log.Info().Dur("drain", s.drain).Msg("draining")
+		timer := time.NewTimer(s.drain)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
 	return s.serve.Shutdown(ctx)
 }
 
 func (s *BooklyAPI) JWTAuthMiddleware() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		log := logger.Get()
+		log := logger.FromContext(ctx.Request.Context())
 		token := ctx.GetHeader("Authorization")
+		if token == "" && s.session.enabled {
+			// CSRFMiddleware has checked state-changing requests already.
+			token = s.sessionToken(ctx)
+		}
 		if token == "" {
-			ctx.String(http.StatusUnauthorized, "token is empty")
+			abortWithError(ctx, errTokenMissing)
 			return
 		}
 		UID, err := utils.ValidToken(token)
 		if err != nil {
 			log.Error().Err(err).Send()
-			if errors.Is(err, utils.ErrInvalidToken) {
-				ctx.String(http.StatusUnauthorized, err.Error())
-				return
-			}
-			ctx.String(http.StatusInternalServerError, err.Error())
+			abortWithError(ctx, err)
 			return
 		}
 		ctx.Set("uid", UID)
+		_, admin := s.admins[UID]
+		rCtx := reqctx.WithUser(ctx.Request.Context(), UID, admin)
+		log = log.With().Str("uid", UID).Logger()
+		ctx.Request = ctx.Request.WithContext(logger.WithContext(rCtx, log))
 		ctx.Next()
 	}
 }
 
+func (s *BooklyAPI) RequestMetaMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader("X-Request-ID")
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		ctx.Header("X-Request-ID", requestID)
+		rCtx := reqctx.With(ctx.Request.Context(), reqctx.Meta{
+			RequestID: requestID,
+			IP:        ctx.ClientIP(),
+		})
+		logCtx := logger.Get().With().
+			Ctx(rCtx).
+			Str("request_id", requestID).
+			Str("method", ctx.Request.Method).
+			Str("route", ctx.FullPath())
+		// Internal clients authenticated with mTLS are told apart by certificate.
+		if tls := ctx.Request.TLS; tls != nil && len(tls.PeerCertificates) > 0 {
+			logCtx = logCtx.Str("client_cn", tls.PeerCertificates[0].Subject.CommonName)
+		}
+		log := logCtx.Logger()
+		ctx.Request = ctx.Request.WithContext(logger.WithContext(rCtx, log))
+		ctx.Next()
+	}
+}
+
+func (s *BooklyAPI) MetricsMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		metrics.HTTPInFlight.Inc()
+		defer metrics.HTTPInFlight.Dec()
+		ctx.Next()
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(ctx.Writer.Status())
+		metrics.HTTPRequests.WithLabelValues(ctx.Request.Method, route, status).Inc()
+		metrics.HTTPDuration.WithLabelValues(ctx.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (s *BooklyAPI) AdminMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !reqctx.From(ctx.Request.Context()).Admin {
+			abortWithError(ctx, errAdminRequired)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// maxRequestIDLen fits a uuid or a trace id with room to spare.
+const maxRequestIDLen = 64
+
+// validRequestID reports whether a client supplied id is safe to echo back
+// and to write to logs: short and limited to letters, digits and -_.:
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 func (s *BooklyAPI) configRouting() *gin.Engine {
-	router := gin.Default()
+	router := gin.New()
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(func(ctx *gin.Context) { abortWithError(ctx, errNoRoute) })
+	router.NoMethod(func(ctx *gin.Context) { abortWithError(ctx, errNoMethod) })
+	// X-Forwarded-For is only honoured from these, otherwise clients could
+	// pick their own ip and dodge the per-ip limits.
+	if err := router.SetTrustedProxies(s.proxies); err != nil {
+		log := logger.Get()
+		log.Error().Err(err).Msg("invalid trusted proxies, ignoring forwarded headers")
+		_ = router.SetTrustedProxies(nil)
+	}
+	router.Use(
+		otelgin.Middleware(tracing.ServiceName, otelgin.WithFilter(untraced)),
+		s.RequestMetaMiddleware(),
+		s.AccessLogMiddleware(),
+		s.RecoveryMiddleware(),
+		s.MetricsMiddleware(),
+		s.SecurityHeadersMiddleware(),
+		s.CORSMiddleware(),
+	)
+	if s.session.enabled {
+		router.Use(s.CSRFMiddleware())
+	}
 	router.GET("/", func(ctx *gin.Context) { ctx.String(http.StatusOK, "Hello, my friend!") })
-	users := router.Group("/users")
+	router.GET("/healthz", s.healthzHandler)
+	router.GET("/readyz", s.readyzHandler)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	router.GET("/openapi.json", s.openAPIHandler)
+	router.GET("/docs", s.docsHandler)
+	for _, v := range apiVersions {
+		group := router.Group(v.root)
+		if v.deprecated {
+			group.Use(s.DeprecationMiddleware())
+		}
+		s.mountAPI(group, v)
+	}
+	return router
+}
+
+// mountAPI registers version v of the API on api. Versions differ in how
+// books look on the wire and in how the handlers answer.
+func (s *BooklyAPI) mountAPI(api *gin.RouterGroup, v apiVersion) {
+	users := api.Group("/users", s.RateLimitMiddleware(limitAuth, byIP))
 	{
-		users.GET("/info")
-		users.POST("/register", s.registerHendler)
-		users.POST("/login", s.loginHendler)
+		users.POST("/register", s.registerHendler(v))
+		users.POST("/login", s.RateLimitMiddleware(limitLogin, byEmail), s.loginHendler(v))
+		users.POST("/logout", s.logoutHandler)
 	}
-	books := router.Group("/books")
+	bookRoutes := api.Group("/books", s.RateLimitMiddleware(limitBooks, byIP))
 	{
-		books.GET("/:id", s.getBookHandler)
-		books.GET("/", s.getBooksHandler)
-		books.POST("/", s.JWTAuthMiddleware(), s.addBookHandler)
-		books.DELETE("/:id", s.JWTAuthMiddleware(), s.deleteBookHandler)
+		bookRoutes.GET("/trash", s.JWTAuthMiddleware(), s.getTrashHandler(v.books))
+		bookRoutes.GET("/:id", s.getBookHandler(v.books))
+		bookRoutes.GET("/", s.getBooksHandler(v))
+		bookRoutes.POST("/", s.JWTAuthMiddleware(), s.addBookHandler(v))
+		bookRoutes.DELETE("/:id", s.JWTAuthMiddleware(), s.deleteBookHandler(v))
+		bookRoutes.POST("/:id/restore", s.JWTAuthMiddleware(), s.restoreBookHandler(v))
 	}
-	return router
+	admin := api.Group("/admin", s.JWTAuthMiddleware(), s.RateLimitMiddleware(limitAdmin, byUser), s.AdminMiddleware())
+	{
+		admin.POST("/webhooks", s.addWebhookHandler)
+		admin.GET("/webhooks", s.getWebhooksHandler)
+		admin.DELETE("/webhooks/:id", s.deleteWebhookHandler)
+		admin.GET("/webhooks/:id/deliveries", s.getDeliveriesHandler)
+		admin.POST("/webhooks/deliveries/:id/replay", s.replayDeliveryHandler)
+		admin.GET("/audit", s.getAuditHandler)
+		admin.GET("/purge", s.getPurgeHandler)
+		admin.POST("/purge", s.purgeHandler)
+		admin.GET("/log-level", s.getLogLevelHandler)
+		admin.PUT("/log-level", s.setLogLevelHandler)
+	}
+}
+
+// untraced keeps probes and scrapes out of traces.
+func untraced(req *http.Request) bool {
+	switch req.URL.Path {
+	case "/healthz", "/readyz", "/metrics":
+		return false
+	}
+	return true
 }
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/config"
+	"github.com/Dorrrke/gt4-bookly/internal/server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const csrfHeader = "X-CSRF-Token"
+
+// sessionCookies is the cookie auth mode. With it off tokens only travel in
+// the Authorization header.
+type sessionCookies struct {
+	enabled  bool
+	name     string
+	csrfName string
+	domain   string
+	secure   bool
+	sameSite http.SameSite
+	ttl      time.Duration
+}
+
+func newSessionCookies(cfg config.Config) sessionCookies {
+	sameSite := http.SameSiteLaxMode
+	switch cfg.CookieSameSite {
+	case config.SameSiteStrict:
+		sameSite = http.SameSiteStrictMode
+	case config.SameSiteNone:
+		sameSite = http.SameSiteNoneMode
+	}
+	return sessionCookies{
+		enabled:  cfg.CookieMode,
+		name:     cfg.CookieName,
+		csrfName: cfg.CSRFCookieName,
+		domain:   cfg.CookieDomain,
+		secure:   cfg.CookieSecure,
+		sameSite: sameSite,
+		ttl:      cfg.JWTTTL,
+	}
+}
+
+// issueToken hands a new token for uid to the client, as cookies in cookie
+// mode and in the Authorization header otherwise.
+func (s *BooklyAPI) issueToken(ctx *gin.Context, uid string) error {
+	token, err := utils.CreateJWT(uid)
+	if err != nil {
+		return err
+	}
+	if !s.session.enabled {
+		ctx.Header("Authorization", token)
+		return nil
+	}
+	s.setCookie(ctx, s.session.name, token, true, s.session.ttl)
+	// Readable by the front end so it can echo it in the X-CSRF-Token header.
+	s.setCookie(ctx, s.session.csrfName, utils.CSRFToken(token), false, s.session.ttl)
+	return nil
+}
+
+func (s *BooklyAPI) clearSession(ctx *gin.Context) {
+	s.setCookie(ctx, s.session.name, "", true, -1)
+	s.setCookie(ctx, s.session.csrfName, "", false, -1)
+}
+
+func (s *BooklyAPI) setCookie(ctx *gin.Context, name, value string, httpOnly bool, ttl time.Duration) {
+	maxAge := int(ttl.Seconds())
+	if ttl < 0 {
+		maxAge = -1
+	}
+	http.SetCookie(ctx.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   s.session.domain,
+		MaxAge:   maxAge,
+		Secure:   s.session.secure,
+		HttpOnly: httpOnly,
+		SameSite: s.session.sameSite,
+	})
+}
+
+// sessionToken returns the token from the session cookie.
+func (s *BooklyAPI) sessionToken(ctx *gin.Context) string {
+	token, err := ctx.Cookie(s.session.name)
+	if err != nil {
+		return ""
+	}
+	return token
+}
+
+// CSRFMiddleware guards state-changing requests in cookie mode, login and
+// logout included. With a session cookie the X-CSRF-Token header must be the
+// token issued for that session. Without one the header only has to be there:
+// a cross-site form cannot set it and a cross-origin script needs CORS to.
+// Requests carrying their token in the Authorization header are not exposed
+// to CSRF and pass.
+func (s *BooklyAPI) CSRFMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		switch ctx.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			ctx.Next()
+			return
+		}
+		header := ctx.GetHeader(csrfHeader)
+		session := s.sessionToken(ctx)
+		if _, err := utils.ValidToken(session); err != nil {
+			// An expired or foreign cookie is no session to protect and must
+			// not stand in the way of logging in again.
+			session = ""
+		}
+		switch {
+		case session != "":
+			if !utils.ValidCSRF(session, header) {
+				abortWithError(ctx, errCSRFMismatch)
+				return
+			}
+		case ctx.GetHeader("Authorization") == "" && header == "":
+			abortWithError(ctx, errCSRFMismatch)
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,144 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dorrrke/gt4-bookly/internal/storage"
+)
+
+const (
+	sessionCookie = "bookly_session"
+	csrfCookie    = "bookly_csrf"
+)
+
+// browser keeps the cookies a cookie mode server hands out.
+type browser struct {
+	a       *api
+	cookies map[string]*http.Cookie
+}
+
+func newCookieAPI(t *testing.T) *browser {
+	t.Helper()
+	cfg := testConfig()
+	cfg.CookieMode = true
+	return &browser{a: newAPIWithUsers(t, storage.NewUserStor(nil), cfg), cookies: make(map[string]*http.Cookie)}
+}
+
+func (b *browser) do(method, target, csrf string, body any) *httptest.ResponseRecorder {
+	b.a.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			b.a.t.Fatalf("encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if csrf != "" {
+		req.Header.Set("X-CSRF-Token", csrf)
+	}
+	for _, c := range b.cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	b.a.handler.ServeHTTP(rec, req)
+	for _, c := range rec.Result().Cookies() {
+		if c.MaxAge < 0 {
+			delete(b.cookies, c.Name)
+			continue
+		}
+		b.cookies[c.Name] = c
+	}
+	return rec
+}
+
+func (b *browser) csrf() string {
+	if c, ok := b.cookies[csrfCookie]; ok {
+		return c.Value
+	}
+	return ""
+}
+
+func TestCSRFBeforeSession(t *testing.T) {
+	b := newCookieAPI(t)
+	rec := b.do(http.MethodPost, "/api/v2/users/register", "", userBody("reader@example.com"))
+	wantProblem(t, rec, http.StatusForbidden, "csrf_mismatch")
+
+	rec = b.do(http.MethodPost, "/api/v2/users/register", "fetch", userBody("reader@example.com"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register with the header: status %d, body %s", rec.Code, rec.Body)
+	}
+	if b.cookies[sessionCookie] == nil || b.csrf() == "" {
+		t.Fatalf("cookies %v, want the session and csrf cookies", b.cookies)
+	}
+	if rec.Header().Get("Authorization") != "" {
+		t.Fatal("cookie mode also returned the token in the Authorization header")
+	}
+}
+
+func TestCSRFWithSession(t *testing.T) {
+	b := newCookieAPI(t)
+	if rec := b.do(http.MethodPost, "/api/v2/users/register", "fetch", userBody("reader@example.com")); rec.Code != http.StatusCreated {
+		t.Fatalf("register: status %d, body %s", rec.Code, rec.Body)
+	}
+	other := newCookieAPI(t)
+	other.a = b.a
+	if rec := other.do(http.MethodPost, "/api/v2/users/register", "fetch", userBody("other@example.com")); rec.Code != http.StatusCreated {
+		t.Fatalf("register other: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		csrf   string
+		body   any
+	}{
+		{name: "add book without header", method: http.MethodPost, target: "/api/v2/books/", body: bookBody()},
+		{name: "add book with a made up token", method: http.MethodPost, target: "/api/v2/books/", csrf: "fetch",
+			body: bookBody()},
+		{name: "add book with another session's token", method: http.MethodPost, target: "/api/v2/books/",
+			csrf: other.csrf(), body: bookBody()},
+		{name: "delete without header", method: http.MethodDelete, target: "/api/v2/books/" + missingBook},
+		{name: "logout without header", method: http.MethodPost, target: "/api/v2/users/logout"},
+		{name: "login without header", method: http.MethodPost, target: "/api/v2/users/login",
+			body: map[string]any{"email": "reader@example.com", "pass": "password1"}},
+		{name: "login with a made up token", method: http.MethodPost, target: "/api/v2/users/login", csrf: "fetch",
+			body: map[string]any{"email": "reader@example.com", "pass": "password1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantProblem(t, b.do(tt.method, tt.target, tt.csrf, tt.body), http.StatusForbidden, "csrf_mismatch")
+		})
+	}
+
+	if rec := b.do(http.MethodGet, "/api/v2/books/trash", "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("safe method without header: status %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := b.do(http.MethodPost, "/api/v2/books/", b.csrf(), bookBody()); rec.Code != http.StatusCreated {
+		t.Fatalf("add book with the session's token: status %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := b.do(http.MethodPost, "/api/v2/users/logout", b.csrf(), nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("logout with the session's token: status %d, body %s", rec.Code, rec.Body)
+	}
+	if len(b.cookies) != 0 {
+		t.Fatalf("cookies %v left after logout", b.cookies)
+	}
+}
+
+func TestCSRFSkipsHeaderTokens(t *testing.T) {
+	b := newCookieAPI(t)
+	if rec := b.do(http.MethodPost, "/api/v2/users/register", "fetch", userBody("reader@example.com")); rec.Code != http.StatusCreated {
+		t.Fatalf("register: status %d, body %s", rec.Code, rec.Body)
+	}
+	// A script that holds the token sends it itself, browsers never attach
+	// the Authorization header on their own.
+	rec := b.a.do(http.MethodPost, "/api/v2/books/", b.cookies[sessionCookie].Value, bookBody())
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("add book with the Authorization header: status %d, body %s", rec.Code, rec.Body)
+	}
+}
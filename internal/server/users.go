@@ -1,69 +1,74 @@
 package server
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
 	"github.com/Dorrrke/gt4-bookly/internal/logger"
-	"github.com/Dorrrke/gt4-bookly/internal/server/utils"
+	"github.com/Dorrrke/gt4-bookly/internal/ratelimit"
 
 	"github.com/gin-gonic/gin"
 )
 
-func (s *BooklyAPI) loginHendler(ctx *gin.Context) { //nolint:dupl //todo
-	log := logger.Get()
-	var user models.UserLogin
-	err := ctx.ShouldBindBodyWithJSON(&user)
-	if err != nil {
-		log.Error().Err(err).Msg("unmarshall login body failed")
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+func (s *BooklyAPI) loginHendler(v apiVersion) gin.HandlerFunc { //nolint:dupl //todo
+	return func(ctx *gin.Context) {
+		log := logger.FromContext(ctx.Request.Context())
+		var user models.UserLogin
+		if err := s.bindJSON(ctx, &user); err != nil {
+			log.Error().Err(err).Msg("read login user input data failed")
+			abortWithError(ctx, err)
+			return
+		}
+		uid, err := s.uService.LoginUser(ctx.Request.Context(), user)
+		var locked *ratelimit.LockedError
+		if errors.As(err, &locked) {
+			log.Warn().Err(err).Msg("login locked")
+			tooManyRequests(ctx, time.Until(locked.Until), err)
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("user login validate failed")
+			abortWithError(ctx, err)
+			return
+		}
+		if err = s.issueToken(ctx, uid); err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+		v.resp.loggedIn(ctx, uid)
 	}
-	if err = s.valid.Struct(user); err != nil {
-		log.Error().Err(err).Msg("validate login user input data failed")
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	uid, err := s.uService.LoginUser(user)
-	if err != nil {
-		log.Error().Err(err).Msg("user login validate failed")
-		ctx.JSON(http.StatusUnauthorized, gin.H{"msg": "invalid input data", "error": err.Error()})
-		return
-	}
-	token, err := utils.CreateJWT(uid)
-	if err != nil {
-		ctx.String(http.StatusInternalServerError, err.Error())
-		return
-	}
-	ctx.Header("Authorization", token)
-	ctx.String(http.StatusCreated, "User was logined; user id: %s", uid)
 }
 
-func (s *BooklyAPI) registerHendler(ctx *gin.Context) { //nolint:dupl //todo
-	log := logger.Get()
-	var user models.User
-	err := ctx.ShouldBindBodyWithJSON(&user)
-	if err != nil {
-		log.Error().Err(err).Msg("unmarshall body failed")
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	if err = s.valid.Struct(user); err != nil {
-		log.Error().Err(err).Msg("validate user input data failed")
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+func (s *BooklyAPI) registerHendler(v apiVersion) gin.HandlerFunc { //nolint:dupl //todo
+	return func(ctx *gin.Context) {
+		log := logger.FromContext(ctx.Request.Context())
+		var user models.User
+		if err := s.bindJSON(ctx, &user); err != nil {
+			log.Error().Err(err).Msg("read user input data failed")
+			abortWithError(ctx, err)
+			return
+		}
+		uid, err := s.uService.RegisterUser(ctx.Request.Context(), user)
+		if err != nil {
+			log.Error().Err(err).Msg("user register failed")
+			abortWithError(ctx, err)
+			return
+		}
+		if err = s.issueToken(ctx, uid); err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+		v.resp.registered(ctx, uid)
 	}
-	uid, err := s.uService.RegisterUser(user)
-	if err != nil {
-		log.Error().Err(err).Msg("user register failed")
-		ctx.JSON(http.StatusUnauthorized, gin.H{"msg": "invalid input data", "error": err.Error()})
-		return
-	}
-	token, err := utils.CreateJWT(uid)
-	if err != nil {
-		ctx.String(http.StatusInternalServerError, err.Error())
-		return
+}
+
+// logoutHandler drops the session cookies. Header tokens stay valid until
+// they expire, clients just forget them.
+func (s *BooklyAPI) logoutHandler(ctx *gin.Context) {
+	if s.session.enabled {
+		s.clearSession(ctx)
 	}
-	ctx.Header("Authorization", token)
-	ctx.String(http.StatusCreated, "User was created; user id: %s", uid)
+	ctx.Status(http.StatusNoContent)
 }
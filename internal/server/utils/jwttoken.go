@@ -1,7 +1,12 @@
 package utils
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -12,22 +17,57 @@ type Claims struct {
 	UserID string
 }
 
+type jwtKeys struct {
+	sign   []byte
+	verify jwt.VerificationKeySet
+}
+
 var (
-	tokenTTL  = jwt.NewNumericDate(time.Now().Add(time.Hour * 3))
-	secretKey = []byte("SuperSecretKey")
+	tokenTTL    = time.Hour * 3
+	keys        atomic.Pointer[jwtKeys]
+	defaultKeys = newJWTKeys("SuperSecretKey")
 )
 
 var ErrInvalidToken = errors.New("invalid token")
 
+// SetupJWT replaces the token lifetime and keys, it must be called before
+// the server starts.
+func SetupJWT(secret string, ttl time.Duration, verify ...string) {
+	tokenTTL = ttl
+	SetJWTKeys(secret, verify...)
+}
+
+// SetJWTKeys swaps the signing key. Tokens signed with it or any of the
+// verify keys are accepted, so old tokens survive a rotation.
+func SetJWTKeys(secret string, verify ...string) {
+	keys.Store(newJWTKeys(secret, verify...))
+}
+
+func newJWTKeys(secret string, verify ...string) *jwtKeys {
+	k := jwtKeys{sign: []byte(secret)}
+	k.verify.Keys = append(k.verify.Keys, k.sign)
+	for _, v := range verify {
+		k.verify.Keys = append(k.verify.Keys, []byte(v))
+	}
+	return &k
+}
+
+func currentKeys() *jwtKeys {
+	if k := keys.Load(); k != nil {
+		return k
+	}
+	return defaultKeys
+}
+
 func CreateJWT(uid string) (string, error) {
 	claims := Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: tokenTTL,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenTTL)),
 		},
 		UserID: uid,
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenStr, err := token.SignedString(secretKey)
+	tokenStr, err := token.SignedString(currentKeys().sign)
 	if err != nil {
 		return "", err
 	}
@@ -36,14 +76,42 @@ func CreateJWT(uid string) (string, error) {
 
 func ValidToken(tokentStr string) (string, error) {
 	claims := Claims{}
+	verify := currentKeys().verify
 	token, err := jwt.ParseWithClaims(tokentStr, &claims, func(t *jwt.Token) (interface{}, error) {
-		return secretKey, nil
-	})
+		return verify, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if err != nil {
-		return ``, err
+		// Malformed, expired and badly signed tokens are all the caller's fault.
+		return ``, fmt.Errorf("%w: %w", ErrInvalidToken, err)
 	}
 	if !token.Valid {
 		return ``, ErrInvalidToken
 	}
 	return claims.UserID, nil
 }
+
+// CSRFToken ties a CSRF token to a session token: it is an HMAC of the
+// session under the signing key, so it cannot be reused with another session.
+func CSRFToken(session string) string {
+	return csrfMAC(currentKeys().sign, session)
+}
+
+// ValidCSRF reports whether csrf was made by CSRFToken for session, with the
+// signing key or one of the verify keys.
+func ValidCSRF(session, csrf string) bool {
+	for _, key := range currentKeys().verify.Keys {
+		secret, ok := key.([]byte)
+		if ok && hmac.Equal([]byte(csrfMAC(secret, session)), []byte(csrf)) {
+			return true
+		}
+	}
+	return false
+}
+
+func csrfMAC(secret []byte, session string) string {
+	mac := hmac.New(sha256.New, secret)
+	// The prefix keeps the MAC from ever matching a JWT signature.
+	mac.Write([]byte("csrf:"))
+	mac.Write([]byte(session))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
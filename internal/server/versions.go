@@ -0,0 +1,227 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/config"
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	apiV1 = "/api/v1"
+	apiV2 = "/api/v2"
+)
+
+type apiVersion struct {
+	root string
+	// name prefixes the OpenAPI operation ids.
+	name       string
+	books      bookAdapter
+	resp       responder
+	deprecated bool
+}
+
+// apiVersions are mounted in this order. The unversioned routes predate
+// /api/v1 and are kept as its alias until v1 is sunset. Versions differ in
+// the book shape and in how they answer, v1 keeps its status codes and
+// errors.
+var apiVersions = []apiVersion{
+	{root: "", name: "legacy", books: v1Books{}, resp: v1Responses{}, deprecated: true},
+	{root: apiV1, name: "v1", books: v1Books{}, resp: v1Responses{}, deprecated: true},
+	{root: apiV2, name: "v2", books: v2Books{}, resp: v2Responses{}},
+}
+
+// bookDateLayout is how the publication month travels over the wire.
+const bookDateLayout = "2006-01"
+
+// bookAdapter converts between models.Book and the shape an API version
+// puts on the wire. Every version shares the handlers and the storage.
+type bookAdapter interface {
+	// decode reads a new book from the request body through bind.
+	decode(bind func(req any) error) (models.Book, error)
+	one(book models.Book) any
+	list(books []models.Book) any
+	// trash is list for the trash view, which also shows the owner.
+	trash(books []models.Book) any
+	// wire returns a zero value of the type w stands for, for the OpenAPI
+	// document.
+	wire(w bookWire) any
+}
+
+// v1Books keeps the original field names: lable, desc and writed_at.
+type v1Books struct{}
+
+func (v1Books) decode(bind func(req any) error) (models.Book, error) {
+	var req models.BookRequest
+	if err := bind(&req); err != nil {
+		return models.Book{}, err
+	}
+	writedAt, err := parseBookDate("writed_at", req.WritedAt)
+	if err != nil {
+		return models.Book{}, err
+	}
+	return models.Book{
+		BID:         req.BID,
+		Lable:       req.Lable,
+		Author:      req.Author,
+		Description: req.Description,
+		WritedAt:    writedAt,
+	}, nil
+}
+
+func (v1Books) one(book models.Book) any {
+	return models.BookRequest{
+		BID:         book.BID,
+		Lable:       book.Lable,
+		Author:      book.Author,
+		Description: book.Description,
+		WritedAt:    book.WritedAt.Format(bookDateLayout),
+	}
+}
+
+func (v1Books) list(books []models.Book) any {
+	if books == nil {
+		return []models.Book{}
+	}
+	return books
+}
+
+func (v1Books) trash(books []models.Book) any {
+	out := make([]models.TrashedBook, 0, len(books))
+	for _, book := range books {
+		out = append(out, models.TrashedBook{Book: book, Owner: book.Owner})
+	}
+	return out
+}
+
+func (v1Books) wire(w bookWire) any {
+	switch w {
+	case bookIn, bookOne:
+		return models.BookRequest{}
+	case bookList:
+		return []models.Book{}
+	case bookTrash:
+		return []models.TrashedBook{}
+	}
+	return nil
+}
+
+// v2Books names fields title, description and published_at. Public
+// responses leave out who owns or deleted a book, only the trash shows it.
+type v2Books struct{}
+
+func (v2Books) decode(bind func(req any) error) (models.Book, error) {
+	var req models.BookRequestV2
+	if err := bind(&req); err != nil {
+		return models.Book{}, err
+	}
+	publishedAt, err := parseBookDate("published_at", req.PublishedAt)
+	if err != nil {
+		return models.Book{}, err
+	}
+	return models.Book{
+		Lable:       req.Title,
+		Author:      req.Author,
+		Description: req.Description,
+		WritedAt:    publishedAt,
+	}, nil
+}
+
+func (v2Books) one(book models.Book) any {
+	return bookV2(book)
+}
+
+func (v2Books) list(books []models.Book) any {
+	out := make([]models.BookV2, 0, len(books))
+	for _, book := range books {
+		out = append(out, bookV2(book))
+	}
+	return out
+}
+
+func (v2Books) trash(books []models.Book) any {
+	out := make([]models.TrashedBookV2, 0, len(books))
+	for _, book := range books {
+		out = append(out, models.TrashedBookV2{
+			BookV2:    bookV2(book),
+			Owner:     book.Owner,
+			DeletedAt: book.DeletedAt,
+			DeletedBy: book.DeletedBy,
+		})
+	}
+	return out
+}
+
+func (v2Books) wire(w bookWire) any {
+	switch w {
+	case bookIn:
+		return models.BookRequestV2{}
+	case bookOne:
+		return models.BookV2{}
+	case bookList:
+		return []models.BookV2{}
+	case bookTrash:
+		return []models.TrashedBookV2{}
+	}
+	return nil
+}
+
+func bookV2(book models.Book) models.BookV2 {
+	return models.BookV2{
+		BID:         book.BID,
+		Title:       book.Lable,
+		Author:      book.Author,
+		Description: book.Description,
+		PublishedAt: book.WritedAt.Format(bookDateLayout),
+	}
+}
+
+func parseBookDate(field, val string) (time.Time, error) {
+	t, err := time.Parse(bookDateLayout, val)
+	if err != nil {
+		return t, &inputError{field: field, msg: "must be a year and month like 2006-01", err: err}
+	}
+	return t, nil
+}
+
+// deprecation is announced on every response of a deprecated API version
+// with the Deprecation (RFC 9745) and Sunset (RFC 8594) headers.
+type deprecation struct {
+	since     time.Time
+	sunset    time.Time
+	successor string
+}
+
+func newV1Deprecation(cfg config.Config) (deprecation, error) {
+	d := deprecation{successor: apiV2}
+	var err error
+	if d.since, err = time.Parse(time.DateOnly, cfg.APIV1Deprecated); err != nil {
+		return d, fmt.Errorf("api.v1_deprecated: %w", err)
+	}
+	if cfg.APIV1Sunset == "" {
+		return d, nil
+	}
+	if d.sunset, err = time.Parse(time.DateOnly, cfg.APIV1Sunset); err != nil {
+		return d, fmt.Errorf("api.v1_sunset: %w", err)
+	}
+	return d, nil
+}
+
+func (s *BooklyAPI) DeprecationMiddleware() gin.HandlerFunc {
+	d := s.v1Deprecation
+	since := "@" + strconv.FormatInt(d.since.Unix(), 10)
+	link := "<" + d.successor + `>; rel="successor-version"`
+	return func(ctx *gin.Context) {
+		ctx.Header("Deprecation", since)
+		if !d.sunset.IsZero() {
+			ctx.Header("Sunset", d.sunset.Format(http.TimeFormat))
+		}
+		ctx.Header("Link", link)
+		ctx.Next()
+	}
+}
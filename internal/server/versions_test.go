@@ -0,0 +1,197 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestV2BookFields(t *testing.T) {
+	a := newAPI(t)
+	token := a.register("owner@example.com")
+
+	rec := a.do(http.MethodPost, "/api/v2/books/", token, map[string]any{
+		"title": "Dune", "author": "Frank Herbert", "description": "Spice", "published_at": "1965-08",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d, want 201, body %s", rec.Code, rec.Body)
+	}
+	var created map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode created book: %v", err)
+	}
+	if created["title"] != "Dune" || created["description"] != "Spice" || created["published_at"] != "1965-08" {
+		t.Fatalf("created book %v", created)
+	}
+	for _, old := range []string{"lable", "desc", "writed_at"} {
+		if _, ok := created[old]; ok {
+			t.Fatalf("created book has v1 field %q: %v", old, created)
+		}
+	}
+	bid, _ := created["bid"].(string)
+	if loc := rec.Header().Get("Location"); loc != "/api/v2/books/"+bid {
+		t.Fatalf("Location %q, want /api/v2/books/%s", loc, bid)
+	}
+
+	// Both versions read the same storage.
+	v1 := a.do(http.MethodGet, "/api/v1/books/"+bid, "", nil)
+	var old map[string]any
+	if err := json.Unmarshal(v1.Body.Bytes(), &old); err != nil {
+		t.Fatalf("decode v1 book: %v", err)
+	}
+	if old["lable"] != "Dune" || old["desc"] != "Spice" || old["writed_at"] != "1965-08" {
+		t.Fatalf("v1 book %v", old)
+	}
+
+	list := a.do(http.MethodGet, "/api/v2/books/", "", nil)
+	var books []map[string]any
+	if err := json.Unmarshal(list.Body.Bytes(), &books); err != nil || len(books) != 1 || books[0]["title"] != "Dune" {
+		t.Fatalf("v2 list: %s (%v)", list.Body, err)
+	}
+}
+
+func TestV2TrashOnlyFields(t *testing.T) {
+	a := newAPI(t)
+	token := a.register("owner@example.com")
+	rec := a.do(http.MethodPost, "/api/v2/books/", token, map[string]any{
+		"title": "Dune", "author": "Frank Herbert", "description": "Spice", "published_at": "1965-08",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("add book: status %d, body %s", rec.Code, rec.Body)
+	}
+	location := rec.Header().Get("Location")
+	trashOnly := []string{"owner", "deleted_at", "deleted_by"}
+	for _, target := range []string{location, "/api/v2/books/"} {
+		body := a.do(http.MethodGet, target, "", nil).Body.String()
+		for _, field := range trashOnly {
+			if strings.Contains(body, `"`+field+`"`) {
+				t.Fatalf("GET %s shows %q: %s", target, field, body)
+			}
+		}
+	}
+
+	if rec = a.do(http.MethodDelete, location, token, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete book: status %d", rec.Code)
+	}
+	trash := a.do(http.MethodGet, "/api/v2/books/trash", token, nil)
+	var books []map[string]any
+	if err := json.Unmarshal(trash.Body.Bytes(), &books); err != nil || len(books) != 1 {
+		t.Fatalf("trash: %s (%v)", trash.Body, err)
+	}
+	for _, field := range trashOnly {
+		if v, _ := books[0][field].(string); v == "" {
+			t.Fatalf("trash does not show %q: %s", field, trash.Body)
+		}
+	}
+	if books[0]["title"] != "Dune" {
+		t.Fatalf("trash book %v", books[0])
+	}
+}
+
+func TestV2BookValidation(t *testing.T) {
+	a := newAPI(t)
+	token := a.register("owner@example.com")
+	rec := a.do(http.MethodPost, "/api/v2/books/", token, map[string]any{
+		"title": "Dune", "author": "Frank Herbert", "description": "Spice", "published_at": "1965",
+	})
+	p := wantProblem(t, rec, http.StatusBadRequest, "validation_failed")
+	if len(p.Errors) != 1 || p.Errors[0].Field != "published_at" {
+		t.Fatalf("field errors %+v, want one for published_at", p.Errors)
+	}
+}
+
+// TestV1Responses pins what v1 and the unversioned routes answered before
+// v2 existed.
+func TestV1Responses(t *testing.T) {
+	for _, root := range []string{"", "/api/v1"} {
+		t.Run("root "+root, func(t *testing.T) {
+			a := newAPI(t)
+			token := a.register("owner@example.com")
+			wantError := func(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+				t.Helper()
+				var body struct {
+					Error string `json:"error"`
+				}
+				if rec.Code != status {
+					t.Fatalf("status %d, want %d, body %s", rec.Code, status, rec.Body)
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error == "" {
+					t.Fatalf("body %s, want {\"error\": ...} (%v)", rec.Body, err)
+				}
+			}
+
+			if rec := a.do(http.MethodGet, root+"/books/", "", nil); rec.Code != http.StatusNoContent {
+				t.Fatalf("empty list: status %d, want 204", rec.Code)
+			}
+			rec := a.do(http.MethodPost, root+"/books/", token, bookBodyV1())
+			bid, ok := strings.CutPrefix(rec.Body.String(), "Book ")
+			bid, _, _ = strings.Cut(bid, " ")
+			if rec.Code != http.StatusCreated || !ok || !strings.HasSuffix(rec.Body.String(), " was saved") {
+				t.Fatalf("add book: status %d, body %s", rec.Code, rec.Body)
+			}
+			if rec = a.do(http.MethodGet, root+"/books/"+bid, "", nil); rec.Code != http.StatusOK {
+				t.Fatalf("get book: status %d", rec.Code)
+			}
+			for _, method := range []string{http.MethodGet, http.MethodDelete} {
+				if rec = a.do(method, root+"/books/"+missingBook, token, nil); rec.Code != http.StatusNoContent {
+					t.Fatalf("%s missing book: status %d, want 204", method, rec.Code)
+				}
+			}
+			wantError(t, a.do(http.MethodPost, root+"/books/"+missingBook+"/restore", token, nil), http.StatusNotFound)
+			wantError(t, a.do(http.MethodPost, root+"/books/", "", bookBodyV1()), http.StatusUnauthorized)
+			wantError(t, a.do(http.MethodPost, root+"/books/", token, map[string]any{"lable": 1}), http.StatusBadRequest)
+			wantError(t, a.do(http.MethodPost, root+"/users/register", "", userBody("owner@example.com")),
+				http.StatusUnauthorized)
+
+			login := map[string]any{"email": "owner@example.com", "pass": "password1"}
+			rec = a.do(http.MethodPost, root+"/users/login", "", login)
+			if rec.Code != http.StatusCreated || !strings.HasPrefix(rec.Body.String(), "User was logined; user id: ") {
+				t.Fatalf("login: status %d, body %s", rec.Code, rec.Body)
+			}
+			rec = a.do(http.MethodDelete, root+"/books/"+bid, token, nil)
+			if rec.Code != http.StatusOK || rec.Body.String() != "Book "+bid+" was deleted" {
+				t.Fatalf("delete book: status %d, body %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestDeprecationHeaders(t *testing.T) {
+	a := newAPI(t)
+	tests := []struct {
+		path       string
+		deprecated bool
+	}{
+		{"/books/", true},
+		{"/api/v1/books/", true},
+		{"/api/v2/books/", false},
+		{"/healthz", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := a.do(http.MethodGet, tt.path, "", nil)
+			// v1 answers an empty list with 204.
+			if rec.Code != http.StatusOK && rec.Code != http.StatusNoContent {
+				t.Fatalf("status %d, want 200 or 204", rec.Code)
+			}
+			h := rec.Header()
+			if !tt.deprecated {
+				if h.Get("Deprecation") != "" || h.Get("Sunset") != "" {
+					t.Fatalf("unexpected deprecation headers %v", h)
+				}
+				return
+			}
+			if dep := h.Get("Deprecation"); !strings.HasPrefix(dep, "@") {
+				t.Fatalf("Deprecation %q, want @<unix time>", dep)
+			}
+			if _, err := http.ParseTime(h.Get("Sunset")); err != nil {
+				t.Fatalf("Sunset %q: %v", h.Get("Sunset"), err)
+			}
+			if link := h.Get("Link"); link != `</api/v2>; rel="successor-version"` {
+				t.Fatalf("Link %q", link)
+			}
+		})
+	}
+}
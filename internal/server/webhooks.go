@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *BooklyAPI) addWebhookHandler(ctx *gin.Context) {
+	log := logger.FromContext(ctx.Request.Context())
+	var req models.WebhookRequest
+	if err := s.bindJSON(ctx, &req); err != nil {
+		log.Error().Err(err).Msg("read webhook input data failed")
+		abortWithError(ctx, err)
+		return
+	}
+	hook, err := s.wService.Register(ctx.Request.Context(), req)
+	if err != nil {
+		log.Error().Err(err).Msg("save webhook failed")
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, hook)
+}
+
+func (s *BooklyAPI) getWebhooksHandler(ctx *gin.Context) {
+	log := logger.FromContext(ctx.Request.Context())
+	hooks, err := s.wService.GetWebhooks(ctx.Request.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("get webhooks failed")
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, hooks)
+}
+
+func (s *BooklyAPI) deleteWebhookHandler(ctx *gin.Context) {
+	log := logger.FromContext(ctx.Request.Context())
+	id := ctx.Param("id")
+	if err := s.wService.DeleteWebhook(ctx.Request.Context(), id); err != nil {
+		log.Error().Err(err).Msg("delete webhook failed")
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (s *BooklyAPI) getDeliveriesHandler(ctx *gin.Context) {
+	log := logger.FromContext(ctx.Request.Context())
+	id := ctx.Param("id")
+	dlvs, err := s.wService.GetDeliveries(ctx.Request.Context(), id)
+	if err != nil {
+		log.Error().Err(err).Msg("get webhook deliveries failed")
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, dlvs)
+}
+
+func (s *BooklyAPI) replayDeliveryHandler(ctx *gin.Context) {
+	log := logger.FromContext(ctx.Request.Context())
+	id := ctx.Param("id")
+	if err := s.wService.Replay(ctx.Request.Context(), id); err != nil {
+		log.Error().Err(err).Msg("replay webhook delivery failed")
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/events"
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/Dorrrke/gt4-bookly/internal/reqctx"
+)
+
+const (
+	AuditBookCreate      = "book.create"
+	AuditBookDelete      = "book.delete"
+	AuditBookRestore     = "book.restore"
+	AuditBookPurge       = "book.purge"
+	AuditUserRegister    = "user.register"
+	AuditUserLogin       = "user.login"
+	AuditUserLoginFailed = "user.login_failed"
+	AuditUserLocked      = "user.locked"
+)
+
+const (
+	auditDefaultLimit = 50
+	auditMaxLimit     = 500
+)
+
+type Auditor interface {
+	// Record stores an entry right away, for actions that change no data of
+	// their own such as logins.
+	Record(ctx context.Context, action, entity, entityID string, before, after any)
+	// Event returns the entry as an outbox event for a mutation to save in
+	// its own transaction.
+	Event(ctx context.Context, action, entity, entityID string, before, after any) (events.Event, error)
+}
+
+type AuditStorage interface {
+	// SaveAuditEntry ignores an entry whose id is already stored, the relay
+	// may hand the same event over twice.
+	SaveAuditEntry(context.Context, models.AuditEntry) error
+	GetAuditEntries(context.Context, models.AuditFilter) ([]models.AuditEntry, int, error)
+}
+
+type AuditService struct {
+	stor AuditStorage
+}
+
+func NewAuditService(stor AuditStorage) AuditService {
+	return AuditService{stor: stor}
+}
+
+func (as *AuditService) Record(ctx context.Context, action, entity, entityID string, before, after any) {
+	log := logger.FromContext(ctx)
+	entry := newAuditEntry(ctx, action, entity, entityID, before, after)
+	if err := as.stor.SaveAuditEntry(context.WithoutCancel(ctx), entry); err != nil {
+		log.Error().Err(err).Str("action", action).Str("entity_id", entityID).Msg("save audit entry failed")
+	}
+}
+
+func (as *AuditService) Event(
+	ctx context.Context, action, entity, entityID string, before, after any,
+) (events.Event, error) {
+	return events.New(events.AuditRecorded, newAuditEntry(ctx, action, entity, entityID, before, after))
+}
+
+// HandleEvent stores the entry of an AuditRecorded event under the event id.
+func (as *AuditService) HandleEvent(ctx context.Context, evt events.Event) error {
+	entry, err := events.Decode[models.AuditEntry](evt)
+	if err != nil {
+		return err
+	}
+	entry.ID = evt.ID
+	return as.stor.SaveAuditEntry(ctx, entry)
+}
+
+func newAuditEntry(ctx context.Context, action, entity, entityID string, before, after any) models.AuditEntry {
+	log := logger.FromContext(ctx)
+	meta := reqctx.From(ctx)
+	entry := models.AuditEntry{
+		At:        time.Now().UTC(),
+		ActorUID:  meta.UID,
+		Action:    action,
+		Entity:    entity,
+		EntityID:  entityID,
+		RequestID: meta.RequestID,
+		IP:        meta.IP,
+	}
+	var err error
+	if entry.Before, err = marshalSnapshot(before); err != nil {
+		log.Error().Err(err).Str("action", action).Msg("marshal audit snapshot failed")
+	}
+	if entry.After, err = marshalSnapshot(after); err != nil {
+		log.Error().Err(err).Str("action", action).Msg("marshal audit snapshot failed")
+	}
+	return entry
+}
+
+func (as *AuditService) GetEntries(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, int, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = auditDefaultLimit
+	}
+	filter.Limit = min(filter.Limit, auditMaxLimit)
+	filter.Offset = max(filter.Offset, 0)
+	return as.stor.GetAuditEntries(ctx, filter)
+}
+
+func marshalSnapshot(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
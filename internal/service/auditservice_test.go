@@ -0,0 +1,72 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/events"
+	"github.com/Dorrrke/gt4-bookly/internal/reqctx"
+	"github.com/Dorrrke/gt4-bookly/internal/service"
+	"github.com/Dorrrke/gt4-bookly/internal/storage"
+)
+
+// TestAuditThroughOutbox covers the audit entry of a mutation: it is saved
+// with the book as an outbox event and stored once the relay dispatches it,
+// a second dispatch of the same event adds nothing.
+func TestAuditThroughOutbox(t *testing.T) {
+	ctx := reqctx.WithUID(context.Background(), "u1")
+	outbox := storage.NewOutbox()
+	auditStor := storage.NewAuditStor()
+	audit := service.NewAuditService(auditStor)
+	books := service.NewBookService(storage.NewBookStor(outbox), &audit)
+	bus := events.NewBus()
+	webhooks := &collector{}
+	bus.Subscribe("webhooks", webhooks.handle, events.Public...)
+	bus.Subscribe("audit", audit.HandleEvent, events.AuditRecorded)
+
+	bid, err := books.AddBook(ctx, models.Book{
+		Lable: "Dune", Author: "Frank Herbert", Description: "Spice", WritedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("add book: %v", err)
+	}
+	if _, total, _ := audit.GetEntries(ctx, models.AuditFilter{}); total != 0 {
+		t.Fatalf("%d audit entries before the relay ran, want them in the outbox", total)
+	}
+
+	pending, err := outbox.FetchPending(ctx, 10)
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("outbox %v (%v), want the book and the audit event", pending, err)
+	}
+	for range 2 {
+		for _, evt := range pending {
+			if _, err = bus.Dispatch(ctx, evt.Event, nil); err != nil {
+				t.Fatalf("dispatch %s: %v", evt.Type, err)
+			}
+		}
+	}
+
+	entries, total, err := audit.GetEntries(ctx, models.AuditFilter{})
+	if err != nil || total != 1 {
+		t.Fatalf("audit entries %+v, total %d (%v), want one", entries, total, err)
+	}
+	if e := entries[0]; e.Action != service.AuditBookCreate || e.EntityID != bid || e.ActorUID != "u1" {
+		t.Fatalf("audit entry %+v", e)
+	}
+	for _, typ := range webhooks.types {
+		if typ == events.AuditRecorded {
+			t.Fatal("webhooks got the audit event")
+		}
+	}
+}
+
+type collector struct {
+	types []events.Type
+}
+
+func (c *collector) handle(_ context.Context, evt events.Event) error {
+	c.types = append(c.types, evt.Type)
+	return nil
+}
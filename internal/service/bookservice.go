@@ -1,38 +1,170 @@
 package service
 
-import "github.com/Dorrrke/gt4-bookly/internal/domain/models"
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/events"
+	"github.com/Dorrrke/gt4-bookly/internal/metrics"
+	"github.com/Dorrrke/gt4-bookly/internal/reqctx"
+	"github.com/Dorrrke/gt4-bookly/internal/tracing"
+	"github.com/google/uuid"
+)
+
+const PurgeJobName = "purge"
+
+var ErrForbidden = errors.New("access to the book is forbidden")
 
 type BookStorage interface {
-	SaveBook(models.Book) (string, error)
-	GetBooks() ([]models.Book, error)
-	GetBook(string) (models.Book, error)
-	DeleteBooks() error
-	SetDeleteBookStatus(string) error
+	SaveBook(context.Context, models.Book, ...events.Event) (string, error)
+	GetBooks(context.Context) ([]models.Book, error)
+	GetBook(context.Context, string) (models.Book, error)
+	GetDeletedBook(context.Context, string) (models.Book, error)
+	GetDeletedBooks(context.Context, string) ([]models.Book, error)
+	DeleteBooks(context.Context, time.Time, ...events.Event) (int, error)
+	SetDeleteBookStatus(context.Context, string, string, ...events.Event) error
+	RestoreBook(context.Context, string, ...events.Event) error
 }
 
 type BookService struct {
-	stor BookStorage
+	stor    BookStorage
+	auditor Auditor
 }
 
-func NewBookService(stor BookStorage) BookService {
-	return BookService{stor: stor}
+func NewBookService(stor BookStorage, auditor Auditor) BookService {
+	return BookService{stor: instrumentedBooks{stor: stor}, auditor: auditor}
 }
 
-func (bs *BookService) AddBook(book models.Book) (string, error) {
-	return bs.stor.SaveBook(book)
+func (bs *BookService) AddBook(ctx context.Context, book models.Book) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "BookService.AddBook")
+	defer tracing.End(span, &err)
+	book.BID = uuid.New()
+	book.Owner = reqctx.From(ctx).UID
+	evt, err := events.NewBookCreated(book)
+	if err != nil {
+		return ``, err
+	}
+	audit, err := bs.auditor.Event(ctx, AuditBookCreate, "book", book.BID.String(), nil, book)
+	if err != nil {
+		return ``, err
+	}
+	bid, err := bs.stor.SaveBook(ctx, book, evt, audit)
+	if err != nil {
+		return ``, err
+	}
+	metrics.BooksCreated.Inc()
+	return bid, nil
 }
-func (bs *BookService) GetBooks() ([]models.Book, error) {
-	return bs.stor.GetBooks()
+func (bs *BookService) GetBooks(ctx context.Context) (_ []models.Book, err error) {
+	ctx, span := tracing.Start(ctx, "BookService.GetBooks")
+	defer tracing.End(span, &err)
+	return bs.stor.GetBooks(ctx)
+}
+
+func (bs *BookService) GetBook(ctx context.Context, bid string) (_ models.Book, err error) {
+	ctx, span := tracing.Start(ctx, "BookService.GetBook")
+	defer tracing.End(span, &err)
+	return bs.stor.GetBook(ctx, bid)
+}
+
+func (bs *BookService) SetDeleteStatus(ctx context.Context, bid string) (err error) {
+	ctx, span := tracing.Start(ctx, "BookService.SetDeleteStatus")
+	defer tracing.End(span, &err)
+	meta := reqctx.From(ctx)
+	book, err := bs.stor.GetBook(ctx, bid)
+	if err != nil {
+		return err
+	}
+	if !meta.Admin && (meta.UID == `` || book.Owner != meta.UID) {
+		return ErrForbidden
+	}
+	uid := meta.UID
+	evt, err := events.NewBookDeleted(bid, uid)
+	if err != nil {
+		return err
+	}
+	audit, err := bs.auditor.Event(ctx, AuditBookDelete, "book", bid, book, nil)
+	if err != nil {
+		return err
+	}
+	if err = bs.stor.SetDeleteBookStatus(ctx, bid, uid, evt, audit); err != nil {
+		return err
+	}
+	metrics.BooksDeleted.Inc()
+	return nil
+}
+
+// GetTrash returns soft-deleted books: every one for admins, only their own for other users.
+func (bs *BookService) GetTrash(ctx context.Context) (_ []models.Book, err error) {
+	ctx, span := tracing.Start(ctx, "BookService.GetTrash")
+	defer tracing.End(span, &err)
+	meta := reqctx.From(ctx)
+	if meta.Admin {
+		return bs.stor.GetDeletedBooks(ctx, ``)
+	}
+	if meta.UID == `` {
+		return nil, ErrForbidden
+	}
+	return bs.stor.GetDeletedBooks(ctx, meta.UID)
 }
 
-func (bs *BookService) GetBook(bid string) (models.Book, error) {
-	return bs.stor.GetBook(bid)
+// RestoreBook takes a book out of the trash and returns it.
+func (bs *BookService) RestoreBook(ctx context.Context, bid string) (_ models.Book, err error) {
+	ctx, span := tracing.Start(ctx, "BookService.RestoreBook")
+	defer tracing.End(span, &err)
+	meta := reqctx.From(ctx)
+	book, err := bs.stor.GetDeletedBook(ctx, bid)
+	if err != nil {
+		return models.Book{}, err
+	}
+	if !meta.Admin && (meta.UID == `` || book.Owner != meta.UID) {
+		return models.Book{}, ErrForbidden
+	}
+	evt, err := events.NewBookRestored(bid)
+	if err != nil {
+		return models.Book{}, err
+	}
+	after := book
+	after.DeletedAt = nil
+	after.DeletedBy = ``
+	audit, err := bs.auditor.Event(ctx, AuditBookRestore, "book", bid, book, after)
+	if err != nil {
+		return models.Book{}, err
+	}
+	if err = bs.stor.RestoreBook(ctx, bid, evt, audit); err != nil {
+		return models.Book{}, err
+	}
+	return after, nil
 }
 
-func (bs *BookService) SetDeleteStatus(bid string) error {
-	return bs.stor.SetDeleteBookStatus(bid)
+func (bs *BookService) DeleteBooks(ctx context.Context, before time.Time) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "BookService.DeleteBooks")
+	defer tracing.End(span, &err)
+	evt, err := events.NewBookPurged(before)
+	if err != nil {
+		return 0, err
+	}
+	// The events are only stored when books were purged. The count is not
+	// known before, the job state keeps it.
+	audit, err := bs.auditor.Event(ctx, AuditBookPurge, "book", "", nil, map[string]any{
+		"deleted_before": before.UTC(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	purged, err := bs.stor.DeleteBooks(ctx, before, evt, audit)
+	metrics.PurgeRuns.WithLabelValues(metrics.Result(err)).Inc()
+	if err != nil {
+		return 0, err
+	}
+	metrics.PurgedBooks.Add(float64(purged))
+	return purged, nil
 }
 
-func (bs *BookService) DeleteBooks() error {
-	return bs.stor.DeleteBooks()
+func (bs *BookService) PurgeDeleted(ctx context.Context, retention time.Duration) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "BookService.PurgeDeleted")
+	defer tracing.End(span, &err)
+	return bs.DeleteBooks(ctx, time.Now().Add(-retention))
 }
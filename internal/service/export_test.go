@@ -0,0 +1,9 @@
+package service
+
+import "time"
+
+// SetTiming shortens the retry backoff and the pending sweep.
+func (ws *WebhookService) SetTiming(backoff, sweep time.Duration) {
+	ws.backoff = backoff
+	ws.sweep = sweep
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/events"
+	"github.com/Dorrrke/gt4-bookly/internal/metrics"
+)
+
+// instrumentedBooks records the latency of every BookStorage call.
+type instrumentedBooks struct {
+	stor BookStorage
+}
+
+func (ib instrumentedBooks) SaveBook(ctx context.Context, book models.Book, evts ...events.Event) (bid string, err error) {
+	defer metrics.ObserveStorage("SaveBook", time.Now(), &err)
+	return ib.stor.SaveBook(ctx, book, evts...)
+}
+
+func (ib instrumentedBooks) GetBooks(ctx context.Context) (books []models.Book, err error) {
+	defer metrics.ObserveStorage("GetBooks", time.Now(), &err)
+	return ib.stor.GetBooks(ctx)
+}
+
+func (ib instrumentedBooks) GetBook(ctx context.Context, bid string) (book models.Book, err error) {
+	defer metrics.ObserveStorage("GetBook", time.Now(), &err)
+	return ib.stor.GetBook(ctx, bid)
+}
+
+func (ib instrumentedBooks) GetDeletedBook(ctx context.Context, bid string) (book models.Book, err error) {
+	defer metrics.ObserveStorage("GetDeletedBook", time.Now(), &err)
+	return ib.stor.GetDeletedBook(ctx, bid)
+}
+
+func (ib instrumentedBooks) GetDeletedBooks(ctx context.Context, owner string) (books []models.Book, err error) {
+	defer metrics.ObserveStorage("GetDeletedBooks", time.Now(), &err)
+	return ib.stor.GetDeletedBooks(ctx, owner)
+}
+
+func (ib instrumentedBooks) DeleteBooks(ctx context.Context, before time.Time, evts ...events.Event) (n int, err error) {
+	defer metrics.ObserveStorage("DeleteBooks", time.Now(), &err)
+	return ib.stor.DeleteBooks(ctx, before, evts...)
+}
+
+func (ib instrumentedBooks) SetDeleteBookStatus(
+	ctx context.Context, bid, deletedBy string, evts ...events.Event,
+) (err error) {
+	defer metrics.ObserveStorage("SetDeleteBookStatus", time.Now(), &err)
+	return ib.stor.SetDeleteBookStatus(ctx, bid, deletedBy, evts...)
+}
+
+func (ib instrumentedBooks) RestoreBook(ctx context.Context, bid string, evts ...events.Event) (err error) {
+	defer metrics.ObserveStorage("RestoreBook", time.Now(), &err)
+	return ib.stor.RestoreBook(ctx, bid, evts...)
+}
@@ -1,38 +1,103 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"strings"
+
 	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/events"
 	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/Dorrrke/gt4-bookly/internal/metrics"
+	"github.com/Dorrrke/gt4-bookly/internal/ratelimit"
+	"github.com/Dorrrke/gt4-bookly/internal/reqctx"
+	"github.com/Dorrrke/gt4-bookly/internal/storage/storageerror"
+	"github.com/Dorrrke/gt4-bookly/internal/tracing"
+	"github.com/google/uuid"
 )
 
 type Storage interface {
-	SaveUser(models.User) (string, error)
-	ValidateUser(models.UserLogin) (string, error)
+	SaveUser(context.Context, models.User, ...events.Event) (string, error)
+	ValidateUser(context.Context, models.UserLogin) (string, error)
 }
 
 type UserService struct {
-	stor Storage
+	stor    Storage
+	auditor Auditor
+	lockout *ratelimit.Lockout
 }
 
-func NewUserService(stor Storage) UserService {
-	return UserService{stor: stor}
+func NewUserService(stor Storage, auditor Auditor, lockout *ratelimit.Lockout) UserService {
+	return UserService{stor: stor, auditor: auditor, lockout: lockout}
 }
 
-func (us *UserService) LoginUser(user models.UserLogin) (string, error) {
-	log := logger.Get()
-	uid, err := us.stor.ValidateUser(user)
+func (us *UserService) LoginUser(ctx context.Context, user models.UserLogin) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.LoginUser")
+	defer tracing.End(span, &err)
+	log := logger.FromContext(ctx)
+	key := strings.ToLower(strings.TrimSpace(user.Email))
+	if err = us.lockout.Check(ctx, key); err != nil {
+		if errors.Is(err, ratelimit.ErrLocked) {
+			return ``, err
+		}
+		// Failing open keeps logins working while the lockout store is down.
+		log.Error().Err(err).Msg("check login lockout failed")
+	}
+	uid, err := us.stor.ValidateUser(ctx, user)
+	metrics.Logins.WithLabelValues(metrics.Result(err)).Inc()
 	if err != nil {
-		log.Error().Err(err).Msg("validate user failed")
+		log.Error().Ctx(ctx).Err(err).Msg("validate user failed")
+		us.auditor.Record(ctx, AuditUserLoginFailed, "user", user.Email, nil, map[string]string{"reason": err.Error()})
+		if errors.Is(err, storageerror.ErrInvalidPassword) || errors.Is(err, storageerror.ErrUserNoExist) {
+			return ``, us.loginFailed(ctx, key, err)
+		}
 		return ``, err
 	}
+	if err := us.lockout.Reset(ctx, key); err != nil {
+		log.Error().Err(err).Msg("reset login failures failed")
+	}
+	us.auditor.Record(reqctx.WithUID(ctx, uid), AuditUserLogin, "user", uid, nil, nil)
 	return uid, nil
 }
 
-func (us *UserService) RegisterUser(user models.User) (string, error) {
-	log := logger.Get()
-	uid, err := us.stor.SaveUser(user)
+// loginFailed counts a wrong email or password and returns the lock error
+// instead of err once the account gets locked.
+func (us *UserService) loginFailed(ctx context.Context, key string, err error) error {
+	lockErr := us.lockout.Fail(ctx, key)
+	var locked *ratelimit.LockedError
+	if !errors.As(lockErr, &locked) {
+		if lockErr != nil {
+			log := logger.FromContext(ctx)
+			log.Error().Err(lockErr).Msg("record login failure failed")
+		}
+		return err
+	}
+	metrics.Lockouts.Inc()
+	us.auditor.Record(ctx, AuditUserLocked, "user", key, nil, map[string]any{"until": locked.Until})
+	return lockErr
+}
+
+func (us *UserService) RegisterUser(ctx context.Context, user models.User) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.RegisterUser")
+	defer tracing.End(span, &err)
+	log := logger.FromContext(ctx)
+	user.UID = uuid.New()
+	evt, err := events.NewUserRegistered(user)
 	if err != nil {
-		log.Error().Err(err).Msg("save user failed")
+		return ``, err
+	}
+	uid := user.UID.String()
+	audit, err := us.auditor.Event(reqctx.WithUID(ctx, uid), AuditUserRegister, "user", uid, nil, map[string]any{
+		"uid":   uid,
+		"name":  user.Name,
+		"email": user.Email,
+		"age":   user.Age,
+	})
+	if err != nil {
+		return ``, err
+	}
+	if _, err = us.stor.SaveUser(ctx, user, evt, audit); err != nil {
+		log.Error().Ctx(ctx).Err(err).Msg("save user failed")
 		return ``, err
 	}
 	return uid, nil
@@ -0,0 +1,339 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/events"
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+const (
+	webhookWorkers     = 4
+	webhookQueueSize   = 100
+	webhookMaxAttempts = 5
+	webhookBackoff     = time.Second
+	webhookTimeout     = 10 * time.Second
+	// webhookSweep is how often deliveries left pending by a full queue or
+	// a restart are put back on the queue.
+	webhookSweep = 30 * time.Second
+	// webhookClaim is how long a replica holds a delivery it sends. It is
+	// well past the time all attempts take, so a claim only runs out when
+	// the replica died.
+	webhookClaim = 5 * time.Minute
+)
+
+var ErrDeliveryQueueFull = errors.New("webhook delivery queue is full")
+
+type WebhookStorage interface {
+	SaveWebhook(context.Context, models.Webhook) (string, error)
+	GetWebhooks(context.Context) ([]models.Webhook, error)
+	GetWebhook(context.Context, string) (models.Webhook, error)
+	DeleteWebhook(context.Context, string) error
+	SaveDelivery(context.Context, models.WebhookDelivery) (string, error)
+	UpdateDelivery(context.Context, models.WebhookDelivery) error
+	GetDelivery(context.Context, string) (models.WebhookDelivery, error)
+	GetDeliveries(context.Context, string) ([]models.WebhookDelivery, error)
+	// GetPendingDeliveries returns the pending deliveries of all webhooks
+	// that no replica holds a claim on, oldest first.
+	GetPendingDeliveries(context.Context) ([]models.WebhookDelivery, error)
+	// ClaimDelivery atomically claims a pending delivery for lease and
+	// returns its current state, false when it is no longer pending or
+	// another replica holds it. UpdateDelivery to any other status releases
+	// the claim.
+	ClaimDelivery(ctx context.Context, id string, lease time.Duration) (models.WebhookDelivery, bool, error)
+}
+
+type WebhookService struct {
+	stor    WebhookStorage
+	client  *http.Client
+	queue   chan models.WebhookDelivery
+	queued  *queuedSet
+	backoff time.Duration
+	sweep   time.Duration
+	claim   time.Duration
+}
+
+// queuedSet holds the deliveries that are on the queue or being sent, so a
+// sweep does not queue them twice.
+type queuedSet struct {
+	mu  sync.Mutex
+	ids map[uuid.UUID]struct{}
+}
+
+func NewWebhookService(stor WebhookStorage) WebhookService {
+	return WebhookService{
+		stor:    stor,
+		client:  &http.Client{Timeout: webhookTimeout, Transport: otelhttp.NewTransport(http.DefaultTransport)},
+		queue:   make(chan models.WebhookDelivery, webhookQueueSize),
+		queued:  &queuedSet{ids: make(map[uuid.UUID]struct{})},
+		backoff: webhookBackoff,
+		sweep:   webhookSweep,
+		claim:   webhookClaim,
+	}
+}
+
+func (ws *WebhookService) Register(ctx context.Context, req models.WebhookRequest) (models.Webhook, error) {
+	hook := models.Webhook{
+		URL:    req.URL,
+		Secret: req.Secret,
+		Events: req.Events,
+	}
+	id, err := ws.stor.SaveWebhook(ctx, hook)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	return ws.stor.GetWebhook(ctx, id)
+}
+
+func (ws *WebhookService) GetWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	hooks, err := ws.stor.GetWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hooks {
+		hooks[i].Secret = ``
+	}
+	return hooks, nil
+}
+
+func (ws *WebhookService) DeleteWebhook(ctx context.Context, id string) error {
+	return ws.stor.DeleteWebhook(ctx, id)
+}
+
+func (ws *WebhookService) GetDeliveries(ctx context.Context, webhookID string) ([]models.WebhookDelivery, error) {
+	if _, err := ws.stor.GetWebhook(ctx, webhookID); err != nil {
+		return nil, err
+	}
+	return ws.stor.GetDeliveries(ctx, webhookID)
+}
+
+func (ws *WebhookService) Replay(ctx context.Context, id string) error {
+	dlv, err := ws.stor.GetDelivery(ctx, id)
+	if err != nil {
+		return err
+	}
+	dlv.Status = DeliveryPending
+	dlv.Attempts = 0
+	if err = ws.stor.UpdateDelivery(ctx, dlv); err != nil {
+		return err
+	}
+	if err = ws.enqueue(dlv); err != nil {
+		log := logger.FromContext(ctx)
+		log.Warn().Err(err).Str("delivery", id).Msg("delivery left pending for the next sweep")
+	}
+	return nil
+}
+
+func (ws *WebhookService) HandleEvent(ctx context.Context, evt events.Event) error {
+	log := logger.FromContext(ctx)
+	hooks, err := ws.stor.GetWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]any{
+		"id":         evt.ID,
+		"event":      evt.Type,
+		"created_at": evt.OccurredAt,
+		"data":       evt.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		if !slices.Contains(hook.Events, string(evt.Type)) {
+			continue
+		}
+		dlv := models.WebhookDelivery{
+			WebhookID: hook.ID,
+			Event:     string(evt.Type),
+			Payload:   body,
+			Status:    DeliveryPending,
+		}
+		id, err := ws.stor.SaveDelivery(ctx, dlv)
+		if err != nil {
+			log.Error().Err(err).Str("webhook", hook.ID.String()).Msg("save webhook delivery failed")
+			continue
+		}
+		dlv.ID = uuid.MustParse(id)
+		if err = ws.enqueue(dlv); err != nil {
+			log.Warn().Err(err).Str("delivery", id).Msg("delivery left pending for the next sweep")
+		}
+	}
+	return nil
+}
+
+// Run sends queued deliveries until ctx is done. Deliveries still pending
+// in storage, from a full queue or an earlier process, are queued first and
+// then again on every sweep. Every replica runs this, a delivery is only sent
+// by the one that claims it.
+func (ws *WebhookService) Run(ctx context.Context) error {
+	log := logger.FromContext(ctx)
+	defer log.Debug().Msg("webhook workers stoped")
+	ws.requeue(ctx)
+	done := make(chan struct{})
+	for range webhookWorkers {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case dlv := <-ws.queue:
+					ws.deliver(ctx, dlv)
+					ws.queued.remove(dlv.ID)
+				}
+			}
+		}()
+	}
+	ticker := time.NewTicker(ws.sweep)
+	defer ticker.Stop()
+	for running := true; running; {
+		select {
+		case <-ctx.Done():
+			running = false
+		case <-ticker.C:
+			ws.requeue(ctx)
+		}
+	}
+	for range webhookWorkers {
+		<-done
+	}
+	return nil
+}
+
+func (ws *WebhookService) requeue(ctx context.Context) {
+	log := logger.FromContext(ctx)
+	dlvs, err := ws.stor.GetPendingDeliveries(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("load pending webhook deliveries failed")
+		return
+	}
+	for i, dlv := range dlvs {
+		if err = ws.enqueue(dlv); err != nil {
+			log.Warn().Err(err).Int("left", len(dlvs)-i).Msg("pending deliveries wait for the next sweep")
+			return
+		}
+	}
+}
+
+func (ws *WebhookService) QueueDepth() int {
+	return len(ws.queue)
+}
+
+// enqueue never blocks. A delivery that does not fit stays pending in
+// storage and is picked up by the next sweep.
+func (ws *WebhookService) enqueue(dlv models.WebhookDelivery) error {
+	ws.queued.mu.Lock()
+	defer ws.queued.mu.Unlock()
+	if _, ok := ws.queued.ids[dlv.ID]; ok {
+		return nil
+	}
+	select {
+	case ws.queue <- dlv:
+		ws.queued.ids[dlv.ID] = struct{}{}
+		return nil
+	default:
+		return ErrDeliveryQueueFull
+	}
+}
+
+func (q *queuedSet) remove(id uuid.UUID) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.ids, id)
+}
+
+func (ws *WebhookService) deliver(ctx context.Context, dlv models.WebhookDelivery) {
+	log := logger.FromContext(ctx).With().Str("delivery", dlv.ID.String()).Logger()
+	dlv, claimed, err := ws.stor.ClaimDelivery(ctx, dlv.ID.String(), ws.claim)
+	if err != nil {
+		log.Error().Err(err).Msg("claim webhook delivery failed")
+		return
+	}
+	if !claimed {
+		log.Debug().Msg("webhook delivery sent or held by another replica")
+		return
+	}
+	hook, err := ws.stor.GetWebhook(ctx, dlv.WebhookID.String())
+	if err != nil {
+		log.Error().Err(err).Msg("get webhook for delivery failed")
+		return
+	}
+	// A delivery resumed after a restart keeps the attempts it already used.
+	for dlv.Attempts < webhookMaxAttempts {
+		if dlv.Attempts > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ws.backoff << (dlv.Attempts - 1)):
+			}
+		}
+		dlv.Attempts++
+		code, err := ws.send(ctx, hook, dlv)
+		dlv.ResponseCode = code
+		if err == nil {
+			now := time.Now()
+			dlv.Status = DeliverySucceeded
+			dlv.LastError = ``
+			dlv.DeliveredAt = &now
+			if err = ws.stor.UpdateDelivery(ctx, dlv); err != nil {
+				log.Error().Err(err).Msg("update webhook delivery failed")
+			}
+			return
+		}
+		log.Warn().Err(err).Int("attempt", dlv.Attempts).Msg("webhook delivery attempt failed")
+		dlv.LastError = err.Error()
+		if dlv.Attempts == webhookMaxAttempts {
+			dlv.Status = DeliveryFailed
+		}
+		if err = ws.stor.UpdateDelivery(ctx, dlv); err != nil {
+			log.Error().Err(err).Msg("update webhook delivery failed")
+		}
+	}
+}
+
+func (ws *WebhookService) send(ctx context.Context, hook models.Webhook, dlv models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(dlv.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Bookly-Event", dlv.Event)
+	req.Header.Set("X-Bookly-Delivery", dlv.ID.String())
+	req.Header.Set("X-Bookly-Signature", "sha256="+Sign(hook.Secret, dlv.Payload))
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
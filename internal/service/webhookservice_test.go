@@ -0,0 +1,257 @@
+package service_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/events"
+	"github.com/Dorrrke/gt4-bookly/internal/service"
+	"github.com/Dorrrke/gt4-bookly/internal/storage"
+)
+
+const hookSecret = "0123456789abcdef"
+
+// receiver answers with the given statuses in turn and 200 once they run out.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	calls    int
+	bodies   [][]byte
+	sigs     []string
+	ids      []string
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.calls++
+	rc.bodies = append(rc.bodies, body)
+	rc.sigs = append(rc.sigs, r.Header.Get("X-Bookly-Signature"))
+	rc.ids = append(rc.ids, r.Header.Get("X-Bookly-Delivery"))
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func startWebhooks(t *testing.T, stor service.WebhookStorage) *service.WebhookService {
+	t.Helper()
+	return startWebhooksSweeping(t, stor, time.Hour)
+}
+
+func startWebhooksSweeping(t *testing.T, stor service.WebhookStorage, sweep time.Duration) *service.WebhookService {
+	t.Helper()
+	ws := service.NewWebhookService(stor)
+	ws.SetTiming(10*time.Millisecond, sweep)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = ws.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return &ws
+}
+
+func register(t *testing.T, ws *service.WebhookService, url string) models.Webhook {
+	t.Helper()
+	hook, err := ws.Register(context.Background(), models.WebhookRequest{
+		URL:    url,
+		Secret: hookSecret,
+		Events: []string{string(events.BookCreated)},
+	})
+	if err != nil {
+		t.Fatalf("register webhook: %v", err)
+	}
+	return hook
+}
+
+// waitDelivery polls until the webhook has one delivery that is no longer pending.
+func waitDelivery(t *testing.T, ws *service.WebhookService, hookID string) models.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		dlvs, err := ws.GetDeliveries(context.Background(), hookID)
+		if err != nil {
+			t.Fatalf("get deliveries: %v", err)
+		}
+		if len(dlvs) == 1 && dlvs[0].Status != service.DeliveryPending {
+			return dlvs[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("delivery is still pending")
+	return models.WebhookDelivery{}
+}
+
+func TestWebhookDeliverySignedAndRetried(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusBadGateway}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	ws := startWebhooks(t, storage.NewWebhookStor())
+	hook := register(t, ws, srv.URL)
+
+	evt, err := events.NewBookCreated(models.Book{Lable: "Dune", Author: "Frank Herbert"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ws.HandleEvent(context.Background(), evt); err != nil {
+		t.Fatalf("handle event: %v", err)
+	}
+
+	dlv := waitDelivery(t, ws, hook.ID.String())
+	if dlv.Status != service.DeliverySucceeded || dlv.Attempts != 3 || dlv.ResponseCode != http.StatusOK {
+		t.Fatalf("delivery %s after %d attempts with %d, want succeeded after 3 with 200",
+			dlv.Status, dlv.Attempts, dlv.ResponseCode)
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.calls != 3 {
+		t.Fatalf("receiver called %d times, want 3", rc.calls)
+	}
+	for i, body := range rc.bodies {
+		mac := hmac.New(sha256.New, []byte(hookSecret))
+		mac.Write(body)
+		if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); rc.sigs[i] != want {
+			t.Errorf("attempt %d: X-Bookly-Signature %q, want %q", i+1, rc.sigs[i], want)
+		}
+	}
+}
+
+func TestWebhookDeliveryGivesUp(t *testing.T) {
+	rc := &receiver{statuses: []int{
+		http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError,
+		http.StatusInternalServerError, http.StatusInternalServerError,
+	}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	ws := startWebhooks(t, storage.NewWebhookStor())
+	hook := register(t, ws, srv.URL)
+
+	evt, err := events.NewBookCreated(models.Book{Lable: "Dune"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ws.HandleEvent(context.Background(), evt); err != nil {
+		t.Fatalf("handle event: %v", err)
+	}
+	dlv := waitDelivery(t, ws, hook.ID.String())
+	if dlv.Status != service.DeliveryFailed || dlv.Attempts != 5 || dlv.LastError == "" {
+		t.Fatalf("delivery %+v, want failed after 5 attempts", dlv)
+	}
+}
+
+// TestWebhookResumesPending covers deliveries left pending by an earlier
+// process: Run sends them without a new event.
+func TestWebhookResumesPending(t *testing.T) {
+	rc := &receiver{}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	stor := storage.NewWebhookStor()
+	hookID, err := stor.SaveWebhook(context.Background(), models.Webhook{
+		URL: srv.URL, Secret: hookSecret, Events: []string{string(events.BookCreated)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook, err := stor.GetWebhook(context.Background(), hookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stor.SaveDelivery(context.Background(), models.WebhookDelivery{
+		WebhookID: hook.ID,
+		Event:     string(events.BookCreated),
+		Payload:   []byte(`{}`),
+		Status:    service.DeliveryPending,
+		Attempts:  2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ws := startWebhooks(t, stor)
+	dlv := waitDelivery(t, ws, hookID)
+	if dlv.Status != service.DeliverySucceeded || dlv.Attempts != 3 {
+		t.Fatalf("delivery %s after %d attempts, want succeeded after 3", dlv.Status, dlv.Attempts)
+	}
+}
+
+// TestWebhookSentOnceAcrossReplicas runs two services on one store, as two
+// replicas on one database: both sweep the same pending deliveries, each is
+// sent once.
+func TestWebhookSentOnceAcrossReplicas(t *testing.T) {
+	rc := &receiver{}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	ctx := context.Background()
+	stor := storage.NewWebhookStor()
+	hookID, err := stor.SaveWebhook(ctx, models.Webhook{
+		URL: srv.URL, Secret: hookSecret, Events: []string{string(events.BookCreated)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook, err := stor.GetWebhook(ctx, hookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const deliveries = 20
+	for range deliveries {
+		if _, err = stor.SaveDelivery(ctx, models.WebhookDelivery{
+			WebhookID: hook.ID,
+			Event:     string(events.BookCreated),
+			Payload:   []byte(`{}`),
+			Status:    service.DeliveryPending,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ws := startWebhooksSweeping(t, stor, 5*time.Millisecond)
+	startWebhooksSweeping(t, stor, 5*time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		dlvs, err := ws.GetDeliveries(ctx, hookID)
+		if err != nil {
+			t.Fatalf("get deliveries: %v", err)
+		}
+		sent := 0
+		for _, dlv := range dlvs {
+			if dlv.Status == service.DeliverySucceeded {
+				sent++
+			}
+		}
+		if sent == deliveries {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d deliveries sent", sent, deliveries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// A few more sweeps on both replicas must not send anything again.
+	time.Sleep(50 * time.Millisecond)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	seen := make(map[string]int)
+	for _, id := range rc.ids {
+		seen[id]++
+	}
+	if len(seen) != deliveries || rc.calls != deliveries {
+		t.Fatalf("receiver got %d calls for %d deliveries, want %d each once", rc.calls, len(seen), deliveries)
+	}
+}
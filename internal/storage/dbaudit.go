@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/google/uuid"
+)
+
+func (dbs *DBStorage) SaveAuditEntry(ctx context.Context, entry models.AuditEntry) error {
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	_, err := dbs.pool.Exec(ctx, `INSERT INTO audit_log
+		(id, at, actor_uid, action, entity, entity_id, before, after, request_id, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) ON CONFLICT (id) DO NOTHING`,
+		entry.ID.String(), entry.At, entry.ActorUID, entry.Action, entry.Entity, entry.EntityID,
+		nullJSON(entry.Before), nullJSON(entry.After), entry.RequestID, entry.IP)
+	return err
+}
+
+func (dbs *DBStorage) GetAuditEntries(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, int, error) {
+	log := logger.Get()
+	var conds []string
+	var args []any
+	addCond := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.ActorUID != "" {
+		addCond("actor_uid = $%d", filter.ActorUID)
+	}
+	if filter.Action != "" {
+		addCond("action = $%d", filter.Action)
+	}
+	if filter.Entity != "" {
+		addCond("entity = $%d", filter.Entity)
+	}
+	if filter.EntityID != "" {
+		addCond("entity_id = $%d", filter.EntityID)
+	}
+	if !filter.From.IsZero() {
+		addCond("at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCond("at < $%d", filter.To)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := dbs.pool.QueryRow(ctx, "SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&total); err != nil {
+		log.Error().Err(err).Msg("failed count audit entries")
+		return nil, 0, err
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query := fmt.Sprintf(`SELECT id, at, actor_uid, action, entity, entity_id, before, after, request_id, ip
+		FROM audit_log%s ORDER BY at DESC LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args))
+	rows, err := dbs.pool.Query(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("failed get data from table audit_log")
+		return nil, 0, err
+	}
+	defer rows.Close()
+	entries := make([]models.AuditEntry, 0)
+	for rows.Next() {
+		var entry models.AuditEntry
+		if err = rows.Scan(&entry.ID, &entry.At, &entry.ActorUID, &entry.Action, &entry.Entity, &entry.EntityID,
+			&entry.Before, &entry.After, &entry.RequestID, &entry.IP); err != nil {
+			log.Error().Err(err).Msg("failed scan rows data")
+			return nil, 0, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, total, rows.Err()
+}
+
+func nullJSON(data []byte) any {
+	if len(data) == 0 {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	healthInterval = 5 * time.Second
+	reconnectMin   = time.Second
+	reconnectMax   = 30 * time.Second
+)
+
+func (dbs *DBStorage) Ping(ctx context.Context) error {
+	return dbs.pool.Ping(ctx)
+}
+
+// MigrationVersion reads the state golang-migrate keeps in schema_migrations.
+func (dbs *DBStorage) MigrationVersion(ctx context.Context) (uint, bool, error) {
+	var version int64
+	var dirty bool
+	err := dbs.pool.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return uint(max(version, 0)), dirty, nil
+}
+
+func (dbs *DBStorage) Stat() *pgxpool.Stat {
+	return dbs.pool.Stat()
+}
+
+func (dbs *DBStorage) Healthy() bool {
+	return dbs.healthy.Load()
+}
+
+// Err returns the error of the last failed ping, nil while healthy.
+func (dbs *DBStorage) Err() error {
+	if err := dbs.lastErr.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// Watch pings the database until ctx is done and flips the health state,
+// backing off exponentially while it is unreachable. onConnect runs after
+// the first successful ping and is retried the same way until it succeeds.
+func (dbs *DBStorage) Watch(ctx context.Context, onConnect func(context.Context) error) error {
+	log := logger.Get()
+	delay := reconnectMin
+	for {
+		err := dbs.pool.Ping(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == nil && onConnect != nil {
+			if err = onConnect(ctx); err == nil {
+				onConnect = nil
+			}
+		}
+		wasHealthy := dbs.healthy.Swap(err == nil)
+		dbs.lastErr.Store(&err)
+		switch {
+		case err == nil && !wasHealthy:
+			log.Info().Msg("database connection established")
+		case err != nil && wasHealthy:
+			log.Error().Err(err).Msg("database connection lost")
+		case err != nil:
+			log.Warn().Err(err).Dur("retry", delay).Msg("database unavailable")
+		}
+
+		wait := healthInterval
+		if err == nil {
+			delay = reconnectMin
+		} else {
+			wait = delay
+			delay = min(delay*2, reconnectMax)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+func (dbs *DBStorage) GetJobState(ctx context.Context, name string) (models.JobState, error) {
+	state := models.JobState{Name: name}
+	row := dbs.pool.QueryRow(ctx, `SELECT last_run_at, last_success_at, last_error, last_result, last_duration_ms,
+		next_run_at, runs_total, failures_total, affected_total, trigger_requested_at FROM job_state WHERE name=$1`, name)
+	err := row.Scan(&state.LastRunAt, &state.LastSuccessAt, &state.LastError, &state.LastResult,
+		&state.LastDurationMS, &state.NextRunAt, &state.RunsTotal, &state.FailuresTotal, &state.AffectedTotal,
+		&state.TriggerRequestedAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return models.JobState{}, err
+	}
+	return state, nil
+}
+
+func (dbs *DBStorage) SaveJobState(ctx context.Context, state models.JobState) error {
+	_, err := dbs.pool.Exec(ctx, `INSERT INTO job_state (name, last_run_at, last_success_at, last_error, last_result,
+		last_duration_ms, next_run_at, runs_total, failures_total, affected_total)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (name) DO UPDATE SET last_run_at = EXCLUDED.last_run_at,
+		last_success_at = EXCLUDED.last_success_at, last_error = EXCLUDED.last_error,
+		last_result = EXCLUDED.last_result, last_duration_ms = EXCLUDED.last_duration_ms,
+		next_run_at = EXCLUDED.next_run_at, runs_total = EXCLUDED.runs_total,
+		failures_total = EXCLUDED.failures_total, affected_total = EXCLUDED.affected_total`,
+		state.Name, state.LastRunAt, state.LastSuccessAt, state.LastError, state.LastResult,
+		state.LastDurationMS, state.NextRunAt, state.RunsTotal, state.FailuresTotal, state.AffectedTotal)
+	return err
+}
+
+func (dbs *DBStorage) RequestRun(ctx context.Context, name string, at time.Time) error {
+	_, err := dbs.pool.Exec(ctx, `INSERT INTO job_state (name, trigger_requested_at) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE
+		SET trigger_requested_at = COALESCE(job_state.trigger_requested_at, EXCLUDED.trigger_requested_at)`,
+		name, at)
+	return err
+}
+
+func (dbs *DBStorage) ClearRunRequest(ctx context.Context, name string, upTo time.Time) error {
+	_, err := dbs.pool.Exec(ctx, `UPDATE job_state SET trigger_requested_at = NULL
+		WHERE name=$1 AND trigger_requested_at <= $2`, name, upTo)
+	return err
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (dbs *DBStorage) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	var owner string
+	row := dbs.pool.QueryRow(ctx, `INSERT INTO leases (name, holder, expires_at)
+		VALUES ($1, $2, NOW() + $3 * interval '1 millisecond')
+		ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+		WHERE leases.holder = EXCLUDED.holder OR leases.expires_at < NOW()
+		RETURNING holder`, name, holder, ttl.Milliseconds())
+	if err := row.Scan(&owner); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return owner == holder, nil
+}
+
+func (dbs *DBStorage) ReleaseLease(ctx context.Context, name, holder string) error {
+	_, err := dbs.pool.Exec(ctx, "DELETE FROM leases WHERE name=$1 AND holder=$2", name, holder)
+	return err
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// refillTokens is the bucket content at NOW(), before taking a token.
+const refillTokens = `LEAST($2::double precision,
+	r.tokens + EXTRACT(EPOCH FROM NOW() - r.updated_at)::double precision * $3::double precision)`
+
+// takenTokens is the bucket content after taking a token if there was one.
+const takenTokens = refillTokens + ` - CASE WHEN ` + refillTokens + ` >= 1 THEN 1 ELSE 0 END`
+
+// TakeToken refills and takes from the bucket in one statement so replicas
+// racing on the same key never hand out more tokens than the bucket holds.
+// full_at is when the bucket is full again and can be deleted.
+func (dbs *DBStorage) TakeToken(ctx context.Context, key string, rate float64, burst int) (bool, float64, error) {
+	var allowed bool
+	var tokens float64
+	row := dbs.pool.QueryRow(ctx, `INSERT INTO rate_limits AS r (key, tokens, allowed, updated_at, full_at)
+		VALUES ($1, $2::double precision - 1, true, NOW(), NOW() + make_interval(secs => 1 / $3::double precision))
+		ON CONFLICT (key) DO UPDATE SET
+			allowed = `+refillTokens+` >= 1,
+			tokens = `+takenTokens+`,
+			updated_at = NOW(),
+			full_at = NOW() + make_interval(secs => ($2::double precision - (`+takenTokens+`)) / $3::double precision)
+		RETURNING allowed, tokens`, key, float64(burst), rate)
+	if err := row.Scan(&allowed, &tokens); err != nil {
+		return false, 0, err
+	}
+	return allowed, tokens, nil
+}
+
+func (dbs *DBStorage) AddLoginFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	var failures int
+	row := dbs.pool.QueryRow(ctx, `INSERT INTO login_failures (key, failures, last_failure_at)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_failures.last_failure_at < NOW() - $2 * interval '1 millisecond' THEN 1
+				ELSE login_failures.failures + 1
+			END,
+			last_failure_at = NOW()
+		RETURNING failures`, key, window.Milliseconds())
+	if err := row.Scan(&failures); err != nil {
+		return 0, err
+	}
+	return failures, nil
+}
+
+func (dbs *DBStorage) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := dbs.pool.Exec(ctx, "UPDATE login_failures SET locked_until=$2 WHERE key=$1", key, until.UTC())
+	return err
+}
+
+func (dbs *DBStorage) LoginLock(ctx context.Context, key string) (time.Time, error) {
+	var until *time.Time
+	row := dbs.pool.QueryRow(ctx, "SELECT locked_until FROM login_failures WHERE key=$1", key)
+	if err := row.Scan(&until); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	if until == nil {
+		return time.Time{}, nil
+	}
+	return *until, nil
+}
+
+func (dbs *DBStorage) ResetLogin(ctx context.Context, key string) error {
+	_, err := dbs.pool.Exec(ctx, "DELETE FROM login_failures WHERE key=$1", key)
+	return err
+}
+
+func (dbs *DBStorage) DeleteExpired(ctx context.Context, window time.Duration) (int, error) {
+	buckets, err := dbs.pool.Exec(ctx, "DELETE FROM rate_limits WHERE full_at < NOW()")
+	if err != nil {
+		return 0, err
+	}
+	logins, err := dbs.pool.Exec(ctx, `DELETE FROM login_failures
+		WHERE last_failure_at < NOW() - $1 * interval '1 millisecond'
+		AND (locked_until IS NULL OR locked_until < NOW())`, window.Milliseconds())
+	if err != nil {
+		return 0, err
+	}
+	return int(buckets.RowsAffected() + logins.RowsAffected()), nil
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/events"
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/jackc/pgx/v5"
+)
+
+func (dbs *DBStorage) FetchPending(ctx context.Context, limit int) ([]events.Pending, error) {
+	log := logger.Get()
+	rows, err := dbs.pool.Query(ctx, `SELECT id, type, payload, occurred_at, attempts, delivered FROM outbox
+		WHERE dispatched_at IS NULL AND dead_at IS NULL AND (retry_at IS NULL OR retry_at <= NOW())
+		ORDER BY occurred_at LIMIT $1`, limit)
+	if err != nil {
+		log.Error().Err(err).Msg("failed get data from table outbox")
+		return nil, err
+	}
+	defer rows.Close()
+	var evts []events.Pending
+	for rows.Next() {
+		var evt events.Pending
+		if err = rows.Scan(&evt.ID, &evt.Type, &evt.Payload, &evt.OccurredAt, &evt.Attempts, &evt.Delivered); err != nil {
+			log.Error().Err(err).Msg("failed scan rows data")
+			return nil, err
+		}
+		evts = append(evts, evt)
+	}
+	return evts, rows.Err()
+}
+
+func (dbs *DBStorage) MarkDispatched(ctx context.Context, id string) error {
+	_, err := dbs.pool.Exec(ctx, "UPDATE outbox SET dispatched_at = NOW() WHERE id=$1", id)
+	return err
+}
+
+func (dbs *DBStorage) MarkFailed(ctx context.Context, id string, f events.Failure) error {
+	var retryAt, deadAt *time.Time
+	if f.Dead {
+		now := time.Now()
+		deadAt = &now
+	} else {
+		retryAt = &f.RetryAt
+	}
+	delivered := f.Delivered
+	if delivered == nil {
+		delivered = []string{}
+	}
+	_, err := dbs.pool.Exec(ctx, `UPDATE outbox SET attempts=$2, delivered=$3, last_error=$4, retry_at=$5, dead_at=$6
+		WHERE id=$1`, id, f.Attempts, delivered, f.Error, retryAt, deadAt)
+	return err
+}
+
+func (dbs *DBStorage) DeleteDispatched(ctx context.Context, retention time.Duration) (int, error) {
+	tag, err := dbs.pool.Exec(ctx, `DELETE FROM outbox
+		WHERE dispatched_at < NOW() - make_interval(secs => $1::double precision)`, retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func insertEvents(ctx context.Context, tx pgx.Tx, evts []events.Event) error {
+	for _, evt := range evts {
+		_, err := tx.Exec(ctx, "INSERT INTO outbox (id, type, payload, occurred_at) VALUES ($1, $2, $3, $4)",
+			evt.ID.String(), string(evt.Type), evt.Payload, evt.OccurredAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,48 +4,101 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"sync/atomic"
 	"time"
 
 	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/events"
 	"github.com/Dorrrke/gt4-bookly/internal/logger"
 	"github.com/Dorrrke/gt4-bookly/internal/storage/storageerror"
+	"github.com/exaring/otelpgx"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/google/uuid"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
 
+type PoolConfig struct {
+	MaxConns          int
+	MinConns          int
+	HealthCheckPeriod time.Duration
+	StatementCache    int
+}
+
 type DBStorage struct {
-	conn *pgx.Conn
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+	lastErr atomic.Pointer[error]
+}
+
+func NewDB(ctx context.Context, addr string, pc PoolConfig) (*DBStorage, error) {
+	dbs, err := OpenDB(addr, pc)
+	if err != nil {
+		return nil, err
+	}
+	if err = dbs.pool.Ping(ctx); err != nil {
+		dbs.pool.Close()
+		return nil, err
+	}
+	dbs.healthy.Store(true)
+	return dbs, nil
 }
 
-func NewDB(ctx context.Context, addr string) (*DBStorage, error) {
-	conn, err := pgx.Connect(ctx, addr)
+// OpenDB creates the pool without connecting, the storage stays unhealthy
+// until Watch reaches the database.
+func OpenDB(addr string, pc PoolConfig) (*DBStorage, error) {
+	poolCfg, err := pgxpool.ParseConfig(addr)
 	if err != nil {
 		return nil, err
 	}
-	return &DBStorage{conn: conn}, nil
+	if pc.MaxConns > 0 {
+		poolCfg.MaxConns = int32(min(pc.MaxConns, math.MaxInt32))
+	}
+	if pc.MinConns > 0 {
+		poolCfg.MinConns = int32(min(pc.MinConns, math.MaxInt32))
+	}
+	if pc.HealthCheckPeriod > 0 {
+		poolCfg.HealthCheckPeriod = pc.HealthCheckPeriod
+	}
+	if pc.StatementCache > 0 {
+		poolCfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+		poolCfg.ConnConfig.StatementCacheCapacity = pc.StatementCache
+	}
+	poolCfg.ConnConfig.Tracer = otelpgx.NewTracer(otelpgx.WithTrimSQLInSpanName())
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &DBStorage{pool: pool}, nil
 }
 
 func (dbs *DBStorage) Close() error {
-	return dbs.conn.Close(context.Background())
+	dbs.pool.Close()
+	return nil
 }
 
-func (dbs *DBStorage) SaveUser(user models.User) (string, error) {
+func (dbs *DBStorage) SaveUser(ctx context.Context, user models.User, evts ...events.Event) (string, error) {
 	log := logger.Get()
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
 	hash, err := bcrypt.GenerateFromPassword([]byte(user.Passoword), bcrypt.DefaultCost)
 	if err != nil {
 		return ``, err
 	}
 	user.Passoword = string(hash)
-	uid := uuid.New()
-	user.UID = uid
-	_, err = dbs.conn.Exec(ctx, "INSERT INTO users (uid, name, email, pass, age) VALUES ($1, $2, $3, $4, $5)",
-		user.UID, user.Name, user.Email, user.Passoword, user.Age)
+	if user.UID == uuid.Nil {
+		user.UID = uuid.New()
+	}
+	err = dbs.inTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "INSERT INTO users (uid, name, email, pass, age) VALUES ($1, $2, $3, $4, $5)",
+			user.UID, user.Name, user.Email, user.Passoword, user.Age)
+		if err != nil {
+			return err
+		}
+		return insertEvents(ctx, tx, evts)
+	})
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
@@ -56,14 +109,12 @@ func (dbs *DBStorage) SaveUser(user models.User) (string, error) {
 		log.Error().Err(err).Msg("failed isert user")
 		return "", err
 	}
-	return uid.String(), nil
+	return user.UID.String(), nil
 }
 
-func (dbs *DBStorage) ValidateUser(user models.UserLogin) (string, error) {
+func (dbs *DBStorage) ValidateUser(ctx context.Context, user models.UserLogin) (string, error) {
 	log := logger.Get()
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	row := dbs.conn.QueryRow(ctx, "SELECT uid, email, pass FROM users WHERE email = $1", user.Email)
+	row := dbs.pool.QueryRow(ctx, "SELECT uid, email, pass FROM users WHERE email = $1", user.Email)
 	var usr models.User
 	if err := row.Scan(&usr.UID, &usr.Email, &usr.Passoword); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -78,34 +129,29 @@ func (dbs *DBStorage) ValidateUser(user models.UserLogin) (string, error) {
 	return usr.UID.String(), nil
 }
 
-func (dbs *DBStorage) GetBooks() ([]models.Book, error) {
+func (dbs *DBStorage) GetBooks(ctx context.Context) ([]models.Book, error) {
 	log := logger.Get()
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	rows, err := dbs.conn.Query(ctx, "SELECT bid, lable, author, descriptons, WritedAt FROM books WHERE deleted = false")
+	rows, err := dbs.pool.Query(ctx, "SELECT bid, lable, author, descriptons, WritedAt, owner FROM books WHERE deleted = false")
 	if err != nil {
 		log.Error().Err(err).Msg("failed get data from table books")
 		return nil, err
 	}
+	defer rows.Close()
 	var books []models.Book
 	for rows.Next() {
 		var book models.Book
-		if err = rows.Scan(&book.BID, &book.Lable, &book.Author, &book.Description, &book.WritedAt); err != nil {
+		if err = rows.Scan(&book.BID, &book.Lable, &book.Author, &book.Description, &book.WritedAt, &book.Owner); err != nil {
 			log.Error().Err(err).Msg("failed scan rows data")
 			return nil, err
 		}
 		books = append(books, book)
 	}
-	return books, nil
+	return books, rows.Err()
 }
 
-func (dbs *DBStorage) SaveBook(book models.Book) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
+func (dbs *DBStorage) SaveBook(ctx context.Context, book models.Book, evts ...events.Event) (string, error) {
 	var bid string
-	row := dbs.conn.QueryRow(ctx, "SELECT bid FROM books WHERE lable=$1 AND author=$2", book.Lable, book.Author)
+	row := dbs.pool.QueryRow(ctx, "SELECT bid FROM books WHERE lable=$1 AND author=$2", book.Lable, book.Author)
 	err := row.Scan(&bid)
 	if err == nil {
 		return ``, storageerror.ErrBookAlredyExist
@@ -113,23 +159,33 @@ func (dbs *DBStorage) SaveBook(book models.Book) (string, error) {
 	if !errors.Is(err, pgx.ErrNoRows) {
 		return ``, err
 	}
-	nBid := uuid.New()
-	book.BID = nBid
-	_, err = dbs.conn.Exec(ctx, "INSERT INTO books (bid, lable, author, descriptons, WritedAt) VALUES ($1, $2, $3, $4, $5)",
-		book.BID.String(), book.Lable, book.Author, book.Description, book.WritedAt)
+	if book.BID == uuid.Nil {
+		book.BID = uuid.New()
+	}
+	err = dbs.inTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `INSERT INTO books (bid, lable, author, descriptons, WritedAt, owner)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			book.BID.String(), book.Lable, book.Author, book.Description, book.WritedAt, book.Owner)
+		if err != nil {
+			return err
+		}
+		return insertEvents(ctx, tx, evts)
+	})
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return ``, storageerror.ErrBookAlredyExist
+		}
 		return ``, err
 	}
 	return book.BID.String(), nil
 }
 
-func (dbs *DBStorage) GetBook(bid string) (models.Book, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
+func (dbs *DBStorage) GetBook(ctx context.Context, bid string) (models.Book, error) {
 	var book models.Book
-	row := dbs.conn.QueryRow(ctx, "SELECT * FROM books WHERE bid=$1 AND deleted = false", bid)
-	err := row.Scan(&book.BID, &book.Lable, &book.Author, &book.Description, &book.WritedAt)
+	row := dbs.pool.QueryRow(ctx, `SELECT bid, lable, author, descriptons, WritedAt, owner
+		FROM books WHERE bid=$1 AND deleted = false`, bid)
+	err := row.Scan(&book.BID, &book.Lable, &book.Author, &book.Description, &book.WritedAt, &book.Owner)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return models.Book{}, storageerror.ErrBookNoFound
@@ -139,37 +195,115 @@ func (dbs *DBStorage) GetBook(bid string) (models.Book, error) {
 	return book, nil
 }
 
-func (dbs *DBStorage) SetDeleteBookStatus(bid string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	_, err := dbs.conn.Exec(ctx, "UPDATE books SET deleted = true WHERE bid=$1", bid)
+func (dbs *DBStorage) GetDeletedBook(ctx context.Context, bid string) (models.Book, error) {
+	row := dbs.pool.QueryRow(ctx, `SELECT bid, lable, author, descriptons, WritedAt, owner, deleted_at,
+		COALESCE(deleted_by, '') FROM books WHERE bid=$1 AND deleted = true`, bid)
+	book, err := scanDeletedBook(row)
 	if err != nil {
-		return err
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Book{}, storageerror.ErrBookNoFound
+		}
+		return models.Book{}, err
 	}
-	return nil
+	return book, nil
+}
+
+func (dbs *DBStorage) GetDeletedBooks(ctx context.Context, owner string) ([]models.Book, error) {
+	log := logger.Get()
+	rows, err := dbs.pool.Query(ctx, `SELECT bid, lable, author, descriptons, WritedAt, owner, deleted_at,
+		COALESCE(deleted_by, '') FROM books WHERE deleted = true AND ($1 = '' OR owner = $1)
+		ORDER BY deleted_at DESC`, owner)
+	if err != nil {
+		log.Error().Err(err).Msg("failed get data from table books")
+		return nil, err
+	}
+	defer rows.Close()
+	books := make([]models.Book, 0)
+	for rows.Next() {
+		book, err := scanDeletedBook(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("failed scan rows data")
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+func (dbs *DBStorage) SetDeleteBookStatus(ctx context.Context, bid, deletedBy string, evts ...events.Event) error {
+	return dbs.inTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `UPDATE books SET deleted = true, deleted_at = NOW(), deleted_by = $2
+			WHERE bid=$1 AND deleted = false`, bid, deletedBy)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return storageerror.ErrBookNoFound
+		}
+		return insertEvents(ctx, tx, evts)
+	})
 }
 
-func (dbs *DBStorage) DeleteBooks() error {
+func (dbs *DBStorage) RestoreBook(ctx context.Context, bid string, evts ...events.Event) error {
+	return dbs.inTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `UPDATE books SET deleted = false, deleted_at = NULL, deleted_by = NULL
+			WHERE bid=$1 AND deleted = true`, bid)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return storageerror.ErrBookNoFound
+		}
+		return insertEvents(ctx, tx, evts)
+	})
+}
+
+func (dbs *DBStorage) DeleteBooks(ctx context.Context, before time.Time, evts ...events.Event) (int, error) {
+	log := logger.Get()
+	var purged int
+	err := dbs.inTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "DELETE FROM books WHERE deleted = true AND deleted_at < $1", before)
+		if err != nil {
+			log.Error().Err(err).Msg("delete books failed")
+			return err
+		}
+		purged = int(tag.RowsAffected())
+		if purged == 0 {
+			return nil
+		}
+		return insertEvents(ctx, tx, evts)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+func (dbs *DBStorage) inTx(ctx context.Context, fn func(pgx.Tx) error) error {
 	log := logger.Get()
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	tx, err := dbs.conn.Begin(ctx)
+	tx, err := dbs.pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed start transaction: %w", err)
 	}
 	defer func() {
 		err := tx.Rollback(ctx)
-		if err != nil {
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
 			log.Error().Err(err).Msg("failed rollback transaction")
 		}
 	}()
-	if _, err = tx.Exec(ctx, "DELETE FROM books WHERE deleted=true"); err != nil {
-		log.Error().Err(err).Msg("delete books failed")
+	if err = fn(tx); err != nil {
 		return err
 	}
 	return tx.Commit(ctx)
 }
 
+func scanDeletedBook(row pgx.Row) (models.Book, error) {
+	var book models.Book
+	err := row.Scan(&book.BID, &book.Lable, &book.Author, &book.Description, &book.WritedAt, &book.Owner,
+		&book.DeletedAt, &book.DeletedBy)
+	return book, err
+}
+
 func Migrations(dbDsn string, migratePath string) error {
 	log := logger.Get()
 	migrPath := fmt.Sprintf("file://%s", migratePath)
@@ -178,6 +312,7 @@ func Migrations(dbDsn string, migratePath string) error {
 		log.Error().Err(err).Msg("failed to db conntect")
 		return err
 	}
+	defer m.Close()
 	if err := m.Up(); err != nil {
 		if errors.Is(err, migrate.ErrNoChange) {
 			log.Debug().Msg("no migratons apply")
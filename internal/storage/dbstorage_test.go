@@ -0,0 +1,30 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Dorrrke/gt4-bookly/internal/storage"
+	"github.com/Dorrrke/gt4-bookly/internal/storage/storagetest"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+)
+
+func TestDBStorage(t *testing.T) {
+	dsn := storagetest.PostgresDSN(t)
+	if err := storage.Migrations(dsn, "../../migrations"); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	stor, err := storage.NewDB(context.Background(), dsn, storage.PoolConfig{MaxConns: 20})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { stor.Close() })
+
+	storagetest.Run(t, func(t *testing.T) storagetest.Backend {
+		if err := stor.Truncate(context.Background()); err != nil {
+			t.Fatalf("truncate: %v", err)
+		}
+		return stor
+	})
+}
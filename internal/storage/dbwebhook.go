@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/Dorrrke/gt4-bookly/internal/storage/storageerror"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func (dbs *DBStorage) SaveWebhook(ctx context.Context, hook models.Webhook) (string, error) {
+	hook.ID = uuid.New()
+	_, err := dbs.pool.Exec(ctx, "INSERT INTO webhooks (id, url, secret, events) VALUES ($1, $2, $3, $4)",
+		hook.ID.String(), hook.URL, hook.Secret, hook.Events)
+	if err != nil {
+		return ``, err
+	}
+	return hook.ID.String(), nil
+}
+
+func (dbs *DBStorage) GetWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	log := logger.Get()
+	rows, err := dbs.pool.Query(ctx, "SELECT id, url, secret, events, created_at FROM webhooks")
+	if err != nil {
+		log.Error().Err(err).Msg("failed get data from table webhooks")
+		return nil, err
+	}
+	defer rows.Close()
+	var hooks []models.Webhook
+	for rows.Next() {
+		var hook models.Webhook
+		if err = rows.Scan(&hook.ID, &hook.URL, &hook.Secret, &hook.Events, &hook.CreatedAt); err != nil {
+			log.Error().Err(err).Msg("failed scan rows data")
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+func (dbs *DBStorage) GetWebhook(ctx context.Context, id string) (models.Webhook, error) {
+	var hook models.Webhook
+	row := dbs.pool.QueryRow(ctx, "SELECT id, url, secret, events, created_at FROM webhooks WHERE id=$1", id)
+	if err := row.Scan(&hook.ID, &hook.URL, &hook.Secret, &hook.Events, &hook.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Webhook{}, storageerror.ErrWebhookNotFound
+		}
+		return models.Webhook{}, err
+	}
+	return hook, nil
+}
+
+func (dbs *DBStorage) DeleteWebhook(ctx context.Context, id string) error {
+	tag, err := dbs.pool.Exec(ctx, "DELETE FROM webhooks WHERE id=$1", id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storageerror.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (dbs *DBStorage) SaveDelivery(ctx context.Context, dlv models.WebhookDelivery) (string, error) {
+	dlv.ID = uuid.New()
+	_, err := dbs.pool.Exec(ctx, `INSERT INTO webhook_deliveries (id, webhook_id, event, payload, status, attempts)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		dlv.ID.String(), dlv.WebhookID.String(), dlv.Event, dlv.Payload, dlv.Status, dlv.Attempts)
+	if err != nil {
+		return ``, err
+	}
+	return dlv.ID.String(), nil
+}
+
+func (dbs *DBStorage) UpdateDelivery(ctx context.Context, dlv models.WebhookDelivery) error {
+	// Finishing a delivery releases the claim, so a replay can claim it at once.
+	tag, err := dbs.pool.Exec(ctx, `UPDATE webhook_deliveries
+		SET status=$2, attempts=$3, response_code=$4, last_error=$5, delivered_at=$6,
+			claimed_until = CASE WHEN $2 = '`+deliveryPending+`' THEN claimed_until END
+		WHERE id=$1`,
+		dlv.ID.String(), dlv.Status, dlv.Attempts, dlv.ResponseCode, dlv.LastError, dlv.DeliveredAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storageerror.ErrDeliveryNotFound
+	}
+	return nil
+}
+
+func (dbs *DBStorage) GetDelivery(ctx context.Context, id string) (models.WebhookDelivery, error) {
+	row := dbs.pool.QueryRow(ctx, `SELECT id, webhook_id, event, payload, status, attempts,
+		COALESCE(response_code, 0), COALESCE(last_error, ''), created_at, delivered_at
+		FROM webhook_deliveries WHERE id=$1`, id)
+	dlv, err := scanDelivery(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.WebhookDelivery{}, storageerror.ErrDeliveryNotFound
+		}
+		return models.WebhookDelivery{}, err
+	}
+	return dlv, nil
+}
+
+func (dbs *DBStorage) GetDeliveries(ctx context.Context, webhookID string) ([]models.WebhookDelivery, error) {
+	log := logger.Get()
+	rows, err := dbs.pool.Query(ctx, `SELECT id, webhook_id, event, payload, status, attempts,
+		COALESCE(response_code, 0), COALESCE(last_error, ''), created_at, delivered_at
+		FROM webhook_deliveries WHERE webhook_id=$1 ORDER BY created_at DESC`, webhookID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed get data from table webhook_deliveries")
+		return nil, err
+	}
+	defer rows.Close()
+	var dlvs []models.WebhookDelivery
+	for rows.Next() {
+		dlv, err := scanDelivery(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("failed scan rows data")
+			return nil, err
+		}
+		dlvs = append(dlvs, dlv)
+	}
+	return dlvs, rows.Err()
+}
+
+func (dbs *DBStorage) GetPendingDeliveries(ctx context.Context) ([]models.WebhookDelivery, error) {
+	log := logger.Get()
+	rows, err := dbs.pool.Query(ctx, `SELECT id, webhook_id, event, payload, status, attempts,
+		COALESCE(response_code, 0), COALESCE(last_error, ''), created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE status=$1 AND (claimed_until IS NULL OR claimed_until < NOW())
+		ORDER BY created_at`, deliveryPending)
+	if err != nil {
+		log.Error().Err(err).Msg("failed get data from table webhook_deliveries")
+		return nil, err
+	}
+	defer rows.Close()
+	var dlvs []models.WebhookDelivery
+	for rows.Next() {
+		dlv, err := scanDelivery(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("failed scan rows data")
+			return nil, err
+		}
+		dlvs = append(dlvs, dlv)
+	}
+	return dlvs, rows.Err()
+}
+
+// ClaimDelivery relies on the row lock of UPDATE: a concurrent claim waits
+// and then sees claimed_until in the future.
+func (dbs *DBStorage) ClaimDelivery(
+	ctx context.Context, id string, lease time.Duration,
+) (models.WebhookDelivery, bool, error) {
+	row := dbs.pool.QueryRow(ctx, `UPDATE webhook_deliveries
+		SET claimed_until = NOW() + make_interval(secs => $2::double precision)
+		WHERE id=$1 AND status=$3 AND (claimed_until IS NULL OR claimed_until < NOW())
+		RETURNING id, webhook_id, event, payload, status, attempts,
+			COALESCE(response_code, 0), COALESCE(last_error, ''), created_at, delivered_at`,
+		id, lease.Seconds(), deliveryPending)
+	dlv, err := scanDelivery(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		dlv, err = dbs.GetDelivery(ctx, id)
+		return dlv, false, err
+	}
+	if err != nil {
+		return models.WebhookDelivery{}, false, err
+	}
+	return dlv, true, nil
+}
+
+func scanDelivery(row pgx.Row) (models.WebhookDelivery, error) {
+	var dlv models.WebhookDelivery
+	err := row.Scan(&dlv.ID, &dlv.WebhookID, &dlv.Event, &dlv.Payload, &dlv.Status, &dlv.Attempts,
+		&dlv.ResponseCode, &dlv.LastError, &dlv.CreatedAt, &dlv.DeliveredAt)
+	return dlv, err
+}
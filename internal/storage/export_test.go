@@ -0,0 +1,15 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+func (dbs *DBStorage) Truncate(ctx context.Context) error {
+	_, err := dbs.pool.Exec(ctx, "TRUNCATE users, books, outbox")
+	return err
+}
+
+func (ss *SQLiteStorage) DB() *sql.DB {
+	return ss.db
+}
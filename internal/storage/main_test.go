@@ -0,0 +1,13 @@
+package storage_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.Get(false)
+	os.Exit(m.Run())
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+type MapAuditStorage struct {
+	mu      sync.RWMutex
+	entries []models.AuditEntry
+}
+
+func NewAuditStor() *MapAuditStorage {
+	return &MapAuditStorage{}
+}
+
+func (ms *MapAuditStorage) SaveAuditEntry(_ context.Context, entry models.AuditEntry) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	if slices.ContainsFunc(ms.entries, func(e models.AuditEntry) bool { return e.ID == entry.ID }) {
+		return nil
+	}
+	ms.entries = append(ms.entries, entry)
+	return nil
+}
+
+func (ms *MapAuditStorage) GetAuditEntries(_ context.Context, filter models.AuditFilter) ([]models.AuditEntry, int, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	matched := make([]models.AuditEntry, 0)
+	for i := len(ms.entries) - 1; i >= 0; i-- {
+		entry := ms.entries[i]
+		if !matchAudit(entry, filter) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+	total := len(matched)
+	start := min(filter.Offset, total)
+	end := min(start+filter.Limit, total)
+	return matched[start:end], total, nil
+}
+
+func matchAudit(entry models.AuditEntry, filter models.AuditFilter) bool {
+	switch {
+	case filter.ActorUID != "" && entry.ActorUID != filter.ActorUID,
+		filter.Action != "" && entry.Action != filter.Action,
+		filter.Entity != "" && entry.Entity != filter.Entity,
+		filter.EntityID != "" && entry.EntityID != filter.EntityID,
+		!filter.From.IsZero() && entry.At.Before(filter.From),
+		!filter.To.IsZero() && !entry.At.Before(filter.To):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+)
+
+type MapJobStorage struct {
+	mu     sync.RWMutex
+	states map[string]models.JobState
+}
+
+func NewJobStor() *MapJobStorage {
+	return &MapJobStorage{
+		states: make(map[string]models.JobState),
+	}
+}
+
+func (ms *MapJobStorage) GetJobState(_ context.Context, name string) (models.JobState, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	state, ok := ms.states[name]
+	if !ok {
+		return models.JobState{Name: name}, nil
+	}
+	return state, nil
+}
+
+func (ms *MapJobStorage) SaveJobState(_ context.Context, state models.JobState) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	state.TriggerRequestedAt = ms.states[state.Name].TriggerRequestedAt
+	ms.states[state.Name] = state
+	return nil
+}
+
+func (ms *MapJobStorage) RequestRun(_ context.Context, name string, at time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	state, ok := ms.states[name]
+	if !ok {
+		state = models.JobState{Name: name}
+	}
+	if state.TriggerRequestedAt == nil {
+		state.TriggerRequestedAt = &at
+	}
+	ms.states[name] = state
+	return nil
+}
+
+func (ms *MapJobStorage) ClearRunRequest(_ context.Context, name string, upTo time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	state, ok := ms.states[name]
+	if ok && state.TriggerRequestedAt != nil && !state.TriggerRequestedAt.After(upTo) {
+		state.TriggerRequestedAt = nil
+		ms.states[name] = state
+	}
+	return nil
+}
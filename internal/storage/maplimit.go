@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limitSweepEvery is how often buckets that refilled completely are dropped,
+// a full bucket behaves the same as a missing one.
+const limitSweepEvery = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+type loginFailures struct {
+	count  int
+	last   time.Time
+	locked time.Time
+}
+
+type MapLimitStorage struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	logins    map[string]*loginFailures
+	lastSweep time.Time
+}
+
+func NewLimitStor() *MapLimitStorage {
+	return &MapLimitStorage{
+		buckets: make(map[string]*bucket),
+		logins:  make(map[string]*loginFailures),
+	}
+}
+
+func (ms *MapLimitStorage) TakeToken(_ context.Context, key string, rate float64, burst int) (bool, float64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	now := time.Now()
+	if now.Sub(ms.lastSweep) > limitSweepEvery {
+		for k, b := range ms.buckets {
+			if now.After(b.full) {
+				delete(ms.buckets, k)
+			}
+		}
+		ms.lastSweep = now
+	}
+	b, ok := ms.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), updated: now}
+		ms.buckets[key] = b
+	}
+	b.tokens = min(float64(burst), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(time.Duration((float64(burst) - b.tokens) / rate * float64(time.Second)))
+	return allowed, b.tokens, nil
+}
+
+func (ms *MapLimitStorage) AddLoginFailure(_ context.Context, key string, window time.Duration) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	now := time.Now()
+	f, ok := ms.logins[key]
+	if !ok || now.Sub(f.last) > window {
+		f = &loginFailures{}
+		ms.logins[key] = f
+	}
+	f.count++
+	f.last = now
+	return f.count, nil
+}
+
+func (ms *MapLimitStorage) LockLogin(_ context.Context, key string, until time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if f, ok := ms.logins[key]; ok {
+		f.locked = until
+	}
+	return nil
+}
+
+func (ms *MapLimitStorage) LoginLock(_ context.Context, key string) (time.Time, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if f, ok := ms.logins[key]; ok {
+		return f.locked, nil
+	}
+	return time.Time{}, nil
+}
+
+func (ms *MapLimitStorage) ResetLogin(_ context.Context, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.logins, key)
+	return nil
+}
+
+func (ms *MapLimitStorage) DeleteExpired(_ context.Context, window time.Duration) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	now := time.Now()
+	var deleted int
+	for k, b := range ms.buckets {
+		if now.After(b.full) {
+			delete(ms.buckets, k)
+			deleted++
+		}
+	}
+	for k, f := range ms.logins {
+		if now.Sub(f.last) > window && now.After(f.locked) {
+			delete(ms.logins, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/events"
+)
+
+type MapOutbox struct {
+	mu   sync.Mutex
+	evts []outboxEntry
+}
+
+type outboxEntry struct {
+	events.Pending
+	retryAt time.Time
+	dead    bool
+}
+
+func NewOutbox() *MapOutbox {
+	return &MapOutbox{}
+}
+
+func (mo *MapOutbox) FetchPending(_ context.Context, limit int) ([]events.Pending, error) {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+	now := time.Now()
+	var evts []events.Pending
+	for _, e := range mo.evts {
+		if len(evts) == limit {
+			break
+		}
+		if e.dead || e.retryAt.After(now) {
+			continue
+		}
+		e.Delivered = slices.Clone(e.Delivered)
+		evts = append(evts, e.Pending)
+	}
+	return evts, nil
+}
+
+func (mo *MapOutbox) MarkDispatched(_ context.Context, id string) error {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+	for i, e := range mo.evts {
+		if e.ID.String() == id {
+			mo.evts = append(mo.evts[:i], mo.evts[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (mo *MapOutbox) MarkFailed(_ context.Context, id string, f events.Failure) error {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+	for i, e := range mo.evts {
+		if e.ID.String() == id {
+			e.Attempts = f.Attempts
+			e.Delivered = slices.Clone(f.Delivered)
+			e.retryAt = f.RetryAt
+			e.dead = f.Dead
+			mo.evts[i] = e
+			return nil
+		}
+	}
+	return nil
+}
+
+// DeleteDispatched has nothing to do, MarkDispatched already drops the event.
+func (mo *MapOutbox) DeleteDispatched(context.Context, time.Duration) (int, error) {
+	return 0, nil
+}
+
+func (mo *MapOutbox) add(evts []events.Event) {
+	if mo == nil || len(evts) == 0 {
+		return
+	}
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+	for _, evt := range evts {
+		mo.evts = append(mo.evts, outboxEntry{Pending: events.Pending{Event: evt}})
+	}
+}
@@ -1,10 +1,13 @@
 package storage
 
 import (
-	"errors"
+	"context"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
-	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/Dorrrke/gt4-bookly/internal/events"
 	"github.com/Dorrrke/gt4-bookly/internal/storage/storageerror"
 
 	"github.com/google/uuid"
@@ -12,102 +15,175 @@ import (
 )
 
 type MapUserStorage struct {
-	stor map[string]models.User
+	mu     sync.RWMutex
+	stor   map[string]models.User
+	outbox *MapOutbox
 }
 
-func NewUserStor() *MapUserStorage {
+func NewUserStor(outbox *MapOutbox) *MapUserStorage {
 	return &MapUserStorage{
-		stor: make(map[string]models.User),
+		stor:   make(map[string]models.User),
+		outbox: outbox,
 	}
 }
 
-func (ms *MapUserStorage) SaveUser(user models.User) (string, error) {
-	log := logger.Get()
-	for _, usr := range ms.stor {
-		if user.Email == usr.Email {
-			return ``, errors.New("user alredy exist")
-		}
-	}
+func (ms *MapUserStorage) SaveUser(_ context.Context, user models.User, evts ...events.Event) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(user.Passoword), bcrypt.DefaultCost)
 	if err != nil {
 		return ``, err
 	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, usr := range ms.stor {
+		if user.Email == usr.Email {
+			return ``, storageerror.ErrUserAlredyExist
+		}
+	}
 	user.Passoword = string(hash)
-	uid := uuid.New()
-	user.UID = uid
+	if user.UID == uuid.Nil {
+		user.UID = uuid.New()
+	}
 	ms.stor[user.UID.String()] = user
-	log.Debug().Any("storage", ms.stor).Msg("check storage")
-	return uid.String(), nil
+	ms.outbox.add(evts)
+	return user.UID.String(), nil
 }
 
-func (ms *MapUserStorage) ValidateUser(user models.UserLogin) (string, error) {
+func (ms *MapUserStorage) ValidateUser(_ context.Context, user models.UserLogin) (string, error) {
+	ms.mu.RLock()
+	var uid, hash string
 	for key, usr := range ms.stor {
 		if user.Email == usr.Email {
-			if err := bcrypt.CompareHashAndPassword([]byte(usr.Passoword), []byte(user.Passoword)); err != nil {
-				return ``, errors.New("invalid user password")
-			}
-			return key, nil
+			uid, hash = key, usr.Passoword
+			break
 		}
 	}
-	return ``, errors.New("user no exist")
+	ms.mu.RUnlock()
+	if uid == `` {
+		return ``, storageerror.ErrUserNoExist
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(user.Passoword)); err != nil {
+		return ``, storageerror.ErrInvalidPassword
+	}
+	return uid, nil
 }
 
 type MapBookStorage struct {
-	bStor map[string]models.Book
+	mu     sync.RWMutex
+	bStor  map[string]models.Book
+	outbox *MapOutbox
 }
 
-func NewBookStor() *MapBookStorage {
+func NewBookStor(outbox *MapOutbox) *MapBookStorage {
 	return &MapBookStorage{
-		bStor: make(map[string]models.Book),
+		bStor:  make(map[string]models.Book),
+		outbox: outbox,
 	}
 }
 
-func (ms *MapBookStorage) SaveBook(book models.Book) (string, error) {
-	log := logger.Get()
+func (ms *MapBookStorage) SaveBook(_ context.Context, book models.Book, evts ...events.Event) (string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
 	for _, b := range ms.bStor {
 		if book.Lable == b.Lable && book.Author == b.Author {
 			return ``, storageerror.ErrBookAlredyExist
 		}
 	}
-	bID := uuid.New()
-	book.BID = bID
+	if book.BID == uuid.Nil {
+		book.BID = uuid.New()
+	}
 	ms.bStor[book.BID.String()] = book
-	log.Debug().Any("book storage", ms.bStor).Msg("check storage")
-	return bID.String(), nil
+	ms.outbox.add(evts)
+	return book.BID.String(), nil
 }
 
-func (ms *MapBookStorage) GetBooks() ([]models.Book, error) {
-	if len(ms.bStor) == 0 {
-		return nil, storageerror.ErrEmptyStorage
-	}
+func (ms *MapBookStorage) GetBooks(_ context.Context) ([]models.Book, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
 	var books []models.Book
 	for _, book := range ms.bStor {
+		if book.DeletedAt != nil {
+			continue
+		}
 		books = append(books, book)
 	}
 	return books, nil
 }
 
-func (ms *MapBookStorage) GetBook(bid string) (models.Book, error) {
+func (ms *MapBookStorage) GetBook(_ context.Context, bid string) (models.Book, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
 	book, ok := ms.bStor[bid]
-	if !ok {
+	if !ok || book.DeletedAt != nil {
 		return models.Book{}, storageerror.ErrBookNoFound
 	}
 	return book, nil
 }
 
-func (ms *MapBookStorage) DeleteBook(bid string) error {
-	_, ok := ms.bStor[bid]
-	if !ok {
+func (ms *MapBookStorage) GetDeletedBook(_ context.Context, bid string) (models.Book, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	book, ok := ms.bStor[bid]
+	if !ok || book.DeletedAt == nil {
+		return models.Book{}, storageerror.ErrBookNoFound
+	}
+	return book, nil
+}
+
+func (ms *MapBookStorage) GetDeletedBooks(_ context.Context, owner string) ([]models.Book, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	books := make([]models.Book, 0)
+	for _, book := range ms.bStor {
+		if book.DeletedAt == nil || (owner != "" && book.Owner != owner) {
+			continue
+		}
+		books = append(books, book)
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].DeletedAt.After(*books[j].DeletedAt) })
+	return books, nil
+}
+
+func (ms *MapBookStorage) SetDeleteBookStatus(_ context.Context, bid, deletedBy string, evts ...events.Event) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	book, ok := ms.bStor[bid]
+	if !ok || book.DeletedAt != nil {
 		return storageerror.ErrBookNoFound
 	}
-	delete(ms.bStor, bid)
+	now := time.Now()
+	book.DeletedAt = &now
+	book.DeletedBy = deletedBy
+	ms.bStor[bid] = book
+	ms.outbox.add(evts)
 	return nil
 }
 
-func (ms *MapBookStorage) DeleteBooks() error {
+func (ms *MapBookStorage) RestoreBook(_ context.Context, bid string, evts ...events.Event) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	book, ok := ms.bStor[bid]
+	if !ok || book.DeletedAt == nil {
+		return storageerror.ErrBookNoFound
+	}
+	book.DeletedAt = nil
+	book.DeletedBy = ``
+	ms.bStor[bid] = book
+	ms.outbox.add(evts)
 	return nil
 }
 
-func (ms *MapBookStorage) SetDeleteBookStatus(bid string) error {
-	return nil
+func (ms *MapBookStorage) DeleteBooks(_ context.Context, before time.Time, evts ...events.Event) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var purged int
+	for bid, book := range ms.bStor {
+		if book.DeletedAt != nil && book.DeletedAt.Before(before) {
+			delete(ms.bStor, bid)
+			purged++
+		}
+	}
+	if purged > 0 {
+		ms.outbox.add(evts)
+	}
+	return purged, nil
 }
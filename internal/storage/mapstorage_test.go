@@ -0,0 +1,59 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/storage"
+	"github.com/Dorrrke/gt4-bookly/internal/storage/storagetest"
+)
+
+type mapBackend struct {
+	*storage.MapUserStorage
+	*storage.MapBookStorage
+}
+
+func TestMapStorage(t *testing.T) {
+	storagetest.Run(t, func(*testing.T) storagetest.Backend {
+		outbox := storage.NewOutbox()
+		return mapBackend{storage.NewUserStor(outbox), storage.NewBookStor(outbox)}
+	})
+}
+
+func TestMapLimitDeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	stor := storage.NewLimitStor()
+	if _, _, err := stor.TakeToken(ctx, "books:fast", 100, 1); err != nil {
+		t.Fatalf("take token: %v", err)
+	}
+	if _, _, err := stor.TakeToken(ctx, "books:slow", 0.001, 1); err != nil {
+		t.Fatalf("take token: %v", err)
+	}
+	if _, err := stor.AddLoginFailure(ctx, "stale", time.Hour); err != nil {
+		t.Fatalf("add login failure: %v", err)
+	}
+	if _, err := stor.AddLoginFailure(ctx, "locked", time.Hour); err != nil {
+		t.Fatalf("add login failure: %v", err)
+	}
+	if err := stor.LockLogin(ctx, "locked", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("lock login: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	deleted, err := stor.DeleteExpired(ctx, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("delete expired: %v", err)
+	}
+	// The refilled bucket and the stale counter go, the slow bucket and the
+	// lock stay.
+	if deleted != 2 {
+		t.Fatalf("deleted %d, want 2", deleted)
+	}
+	if until, _ := stor.LoginLock(ctx, "locked"); until.IsZero() {
+		t.Fatal("a running lock was deleted")
+	}
+	if ok, _, _ := stor.TakeToken(ctx, "books:slow", 0.001, 1); ok {
+		t.Fatal("the empty bucket was deleted and came back full")
+	}
+}
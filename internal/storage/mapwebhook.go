@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/storage/storageerror"
+
+	"github.com/google/uuid"
+)
+
+// deliveryPending matches service.DeliveryPending.
+const deliveryPending = "pending"
+
+type MapWebhookStorage struct {
+	mu    sync.RWMutex
+	hooks map[string]models.Webhook
+	dlvs  map[string]models.WebhookDelivery
+	// claims holds until when a delivery is claimed.
+	claims map[string]time.Time
+}
+
+func NewWebhookStor() *MapWebhookStorage {
+	return &MapWebhookStorage{
+		hooks:  make(map[string]models.Webhook),
+		dlvs:   make(map[string]models.WebhookDelivery),
+		claims: make(map[string]time.Time),
+	}
+}
+
+func (ms *MapWebhookStorage) SaveWebhook(_ context.Context, hook models.Webhook) (string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	hook.ID = uuid.New()
+	hook.CreatedAt = time.Now()
+	ms.hooks[hook.ID.String()] = hook
+	return hook.ID.String(), nil
+}
+
+func (ms *MapWebhookStorage) GetWebhooks(_ context.Context) ([]models.Webhook, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	hooks := make([]models.Webhook, 0, len(ms.hooks))
+	for _, hook := range ms.hooks {
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+func (ms *MapWebhookStorage) GetWebhook(_ context.Context, id string) (models.Webhook, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	hook, ok := ms.hooks[id]
+	if !ok {
+		return models.Webhook{}, storageerror.ErrWebhookNotFound
+	}
+	return hook, nil
+}
+
+func (ms *MapWebhookStorage) DeleteWebhook(_ context.Context, id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.hooks[id]; !ok {
+		return storageerror.ErrWebhookNotFound
+	}
+	delete(ms.hooks, id)
+	for key, dlv := range ms.dlvs {
+		if dlv.WebhookID.String() == id {
+			delete(ms.dlvs, key)
+			delete(ms.claims, key)
+		}
+	}
+	return nil
+}
+
+func (ms *MapWebhookStorage) SaveDelivery(_ context.Context, dlv models.WebhookDelivery) (string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.hooks[dlv.WebhookID.String()]; !ok {
+		return ``, storageerror.ErrWebhookNotFound
+	}
+	dlv.ID = uuid.New()
+	dlv.CreatedAt = time.Now()
+	ms.dlvs[dlv.ID.String()] = dlv
+	return dlv.ID.String(), nil
+}
+
+func (ms *MapWebhookStorage) UpdateDelivery(_ context.Context, dlv models.WebhookDelivery) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	old, ok := ms.dlvs[dlv.ID.String()]
+	if !ok {
+		return storageerror.ErrDeliveryNotFound
+	}
+	old.Status = dlv.Status
+	old.Attempts = dlv.Attempts
+	old.ResponseCode = dlv.ResponseCode
+	old.LastError = dlv.LastError
+	old.DeliveredAt = dlv.DeliveredAt
+	ms.dlvs[dlv.ID.String()] = old
+	if dlv.Status != deliveryPending {
+		delete(ms.claims, dlv.ID.String())
+	}
+	return nil
+}
+
+func (ms *MapWebhookStorage) GetDelivery(_ context.Context, id string) (models.WebhookDelivery, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	dlv, ok := ms.dlvs[id]
+	if !ok {
+		return models.WebhookDelivery{}, storageerror.ErrDeliveryNotFound
+	}
+	return dlv, nil
+}
+
+func (ms *MapWebhookStorage) GetDeliveries(_ context.Context, webhookID string) ([]models.WebhookDelivery, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	var dlvs []models.WebhookDelivery
+	for _, dlv := range ms.dlvs {
+		if dlv.WebhookID.String() == webhookID {
+			dlvs = append(dlvs, dlv)
+		}
+	}
+	sort.Slice(dlvs, func(i, j int) bool { return dlvs[i].CreatedAt.After(dlvs[j].CreatedAt) })
+	return dlvs, nil
+}
+
+func (ms *MapWebhookStorage) GetPendingDeliveries(_ context.Context) ([]models.WebhookDelivery, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	now := time.Now()
+	var dlvs []models.WebhookDelivery
+	for id, dlv := range ms.dlvs {
+		if dlv.Status == deliveryPending && !ms.claims[id].After(now) {
+			dlvs = append(dlvs, dlv)
+		}
+	}
+	sort.Slice(dlvs, func(i, j int) bool { return dlvs[i].CreatedAt.Before(dlvs[j].CreatedAt) })
+	return dlvs, nil
+}
+
+func (ms *MapWebhookStorage) ClaimDelivery(
+	_ context.Context, id string, lease time.Duration,
+) (models.WebhookDelivery, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	dlv, ok := ms.dlvs[id]
+	if !ok {
+		return models.WebhookDelivery{}, false, storageerror.ErrDeliveryNotFound
+	}
+	now := time.Now()
+	if dlv.Status != deliveryPending || ms.claims[id].After(now) {
+		return dlv, false, nil
+	}
+	ms.claims[id] = now.Add(lease)
+	return dlv, true, nil
+}
@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"errors"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4/source/file"
+)
+
+// LatestMigration returns the highest migration version found in migratePath.
+func LatestMigration(migratePath string) (uint, error) {
+	src, err := (&file.File{}).Open("file://" + migratePath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	version, err := src.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
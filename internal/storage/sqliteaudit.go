@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/google/uuid"
+)
+
+func (ss *SQLiteStorage) SaveAuditEntry(ctx context.Context, entry models.AuditEntry) error {
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	_, err := ss.db.ExecContext(ctx, `INSERT INTO audit_log
+		(id, at, actor_uid, action, entity, entity_id, before, after, request_id, ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING`,
+		entry.ID.String(), entry.At.UTC(), entry.ActorUID, entry.Action, entry.Entity, entry.EntityID,
+		nullText(entry.Before), nullText(entry.After), entry.RequestID, entry.IP)
+	return err
+}
+
+func (ss *SQLiteStorage) GetAuditEntries(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, int, error) {
+	log := logger.Get()
+	var conds []string
+	var args []any
+	addCond := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, cond)
+	}
+	if filter.ActorUID != "" {
+		addCond("actor_uid = ?", filter.ActorUID)
+	}
+	if filter.Action != "" {
+		addCond("action = ?", filter.Action)
+	}
+	if filter.Entity != "" {
+		addCond("entity = ?", filter.Entity)
+	}
+	if filter.EntityID != "" {
+		addCond("entity_id = ?", filter.EntityID)
+	}
+	if !filter.From.IsZero() {
+		addCond("julianday(at) >= julianday(?)", filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		addCond("julianday(at) < julianday(?)", filter.To.UTC())
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := ss.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&total); err != nil {
+		log.Error().Err(err).Msg("failed count audit entries")
+		return nil, 0, err
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	rows, err := ss.db.QueryContext(ctx, `SELECT id, at, actor_uid, action, entity, entity_id,
+		COALESCE(before, ''), COALESCE(after, ''), request_id, ip
+		FROM audit_log`+where+` ORDER BY julianday(at) DESC LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("failed get data from table audit_log")
+		return nil, 0, err
+	}
+	defer rows.Close()
+	entries := make([]models.AuditEntry, 0)
+	for rows.Next() {
+		var entry models.AuditEntry
+		var before, after string
+		if err = rows.Scan(&entry.ID, &entry.At, &entry.ActorUID, &entry.Action, &entry.Entity, &entry.EntityID,
+			&before, &after, &entry.RequestID, &entry.IP); err != nil {
+			log.Error().Err(err).Msg("failed scan rows data")
+			return nil, 0, err
+		}
+		if before != "" {
+			entry.Before = []byte(before)
+		}
+		if after != "" {
+			entry.After = []byte(after)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, total, rows.Err()
+}
+
+// nullText is nullJSON for SQLite, which keeps JSON in TEXT columns.
+func nullText(data []byte) any {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+)
+
+func (ss *SQLiteStorage) GetJobState(ctx context.Context, name string) (models.JobState, error) {
+	state := models.JobState{Name: name}
+	row := ss.db.QueryRowContext(ctx, `SELECT last_run_at, last_success_at, last_error, last_result, last_duration_ms,
+		next_run_at, runs_total, failures_total, affected_total, trigger_requested_at FROM job_state WHERE name = ?`, name)
+	err := row.Scan(&state.LastRunAt, &state.LastSuccessAt, &state.LastError, &state.LastResult,
+		&state.LastDurationMS, &state.NextRunAt, &state.RunsTotal, &state.FailuresTotal, &state.AffectedTotal,
+		&state.TriggerRequestedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.JobState{}, err
+	}
+	return state, nil
+}
+
+func (ss *SQLiteStorage) SaveJobState(ctx context.Context, state models.JobState) error {
+	_, err := ss.db.ExecContext(ctx, `INSERT INTO job_state (name, last_run_at, last_success_at, last_error, last_result,
+		last_duration_ms, next_run_at, runs_total, failures_total, affected_total)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET last_run_at = excluded.last_run_at,
+		last_success_at = excluded.last_success_at, last_error = excluded.last_error,
+		last_result = excluded.last_result, last_duration_ms = excluded.last_duration_ms,
+		next_run_at = excluded.next_run_at, runs_total = excluded.runs_total,
+		failures_total = excluded.failures_total, affected_total = excluded.affected_total`,
+		state.Name, utcTime(state.LastRunAt), utcTime(state.LastSuccessAt), state.LastError, state.LastResult,
+		state.LastDurationMS, utcTime(state.NextRunAt), state.RunsTotal, state.FailuresTotal, state.AffectedTotal)
+	return err
+}
+
+func (ss *SQLiteStorage) RequestRun(ctx context.Context, name string, at time.Time) error {
+	_, err := ss.db.ExecContext(ctx, `INSERT INTO job_state (name, trigger_requested_at) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE
+		SET trigger_requested_at = COALESCE(job_state.trigger_requested_at, excluded.trigger_requested_at)`,
+		name, at.UTC())
+	return err
+}
+
+func (ss *SQLiteStorage) ClearRunRequest(ctx context.Context, name string, upTo time.Time) error {
+	_, err := ss.db.ExecContext(ctx, `UPDATE job_state SET trigger_requested_at = NULL
+		WHERE name = ? AND julianday(trigger_requested_at) <= julianday(?)`, name, upTo.UTC())
+	return err
+}
+
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
@@ -0,0 +1,370 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/events"
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/Dorrrke/gt4-bookly/internal/storage/storageerror"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const sqliteBookColumns = `bid, lable, author, descriptons, writed_at, owner, deleted_at, COALESCE(deleted_by, '')`
+
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+// NewSQLite opens the database file at path. SQLite allows a single writer,
+// so the pool is kept to one connection instead of retrying on SQLITE_BUSY.
+// Foreign keys are off in SQLite unless asked for, the webhook deliveries
+// rely on them to go away with their webhook.
+func NewSQLite(ctx context.Context, path string) (*SQLiteStorage, error) {
+	dsn := fmt.Sprintf("file:%s?_time_format=sqlite&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"+
+		"&_pragma=foreign_keys(1)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStorage{db: db}, nil
+}
+
+// SQLiteDSN builds the golang-migrate address for the database file at path.
+func SQLiteDSN(path string) string {
+	return "sqlite://" + path
+}
+
+func (ss *SQLiteStorage) Close() error {
+	return ss.db.Close()
+}
+
+func (ss *SQLiteStorage) Ping(ctx context.Context) error {
+	return ss.db.PingContext(ctx)
+}
+
+func (ss *SQLiteStorage) MigrationVersion(ctx context.Context) (uint, bool, error) {
+	var version int64
+	var dirty bool
+	err := ss.db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return uint(max(version, 0)), dirty, nil
+}
+
+func (ss *SQLiteStorage) SaveUser(ctx context.Context, user models.User, evts ...events.Event) (string, error) {
+	log := logger.Get()
+	hash, err := bcrypt.GenerateFromPassword([]byte(user.Passoword), bcrypt.DefaultCost)
+	if err != nil {
+		return ``, err
+	}
+	user.Passoword = string(hash)
+	if user.UID == uuid.Nil {
+		user.UID = uuid.New()
+	}
+	err = ss.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO users (uid, name, email, pass, age) VALUES (?, ?, ?, ?, ?)",
+			user.UID.String(), user.Name, user.Email, user.Passoword, user.Age)
+		if err != nil {
+			return err
+		}
+		return insertSQLiteEvents(ctx, tx, evts)
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ``, storageerror.ErrUserAlredyExist
+		}
+		log.Error().Err(err).Msg("failed isert user")
+		return ``, err
+	}
+	return user.UID.String(), nil
+}
+
+func (ss *SQLiteStorage) ValidateUser(ctx context.Context, user models.UserLogin) (string, error) {
+	log := logger.Get()
+	row := ss.db.QueryRowContext(ctx, "SELECT uid, pass FROM users WHERE email = ?", user.Email)
+	var uid, hash string
+	if err := row.Scan(&uid, &hash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ``, storageerror.ErrUserNoExist
+		}
+		log.Error().Err(err).Msg("failed scan db data")
+		return ``, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(user.Passoword)); err != nil {
+		return ``, storageerror.ErrInvalidPassword
+	}
+	return uid, nil
+}
+
+func (ss *SQLiteStorage) SaveBook(ctx context.Context, book models.Book, evts ...events.Event) (string, error) {
+	if book.BID == uuid.Nil {
+		book.BID = uuid.New()
+	}
+	err := ss.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO books (bid, lable, author, descriptons, writed_at, owner)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			book.BID.String(), book.Lable, book.Author, book.Description, book.WritedAt.UTC(), book.Owner)
+		if err != nil {
+			return err
+		}
+		return insertSQLiteEvents(ctx, tx, evts)
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ``, storageerror.ErrBookAlredyExist
+		}
+		return ``, err
+	}
+	return book.BID.String(), nil
+}
+
+func (ss *SQLiteStorage) GetBooks(ctx context.Context) ([]models.Book, error) {
+	return ss.queryBooks(ctx, "SELECT "+sqliteBookColumns+" FROM books WHERE deleted_at IS NULL")
+}
+
+func (ss *SQLiteStorage) GetBook(ctx context.Context, bid string) (models.Book, error) {
+	return ss.queryBook(ctx, "SELECT "+sqliteBookColumns+" FROM books WHERE bid = ? AND deleted_at IS NULL", bid)
+}
+
+func (ss *SQLiteStorage) GetDeletedBook(ctx context.Context, bid string) (models.Book, error) {
+	return ss.queryBook(ctx, "SELECT "+sqliteBookColumns+" FROM books WHERE bid = ? AND deleted_at IS NOT NULL", bid)
+}
+
+func (ss *SQLiteStorage) GetDeletedBooks(ctx context.Context, owner string) ([]models.Book, error) {
+	books, err := ss.queryBooks(ctx, "SELECT "+sqliteBookColumns+` FROM books
+		WHERE deleted_at IS NOT NULL AND (? = '' OR owner = ?) ORDER BY julianday(deleted_at) DESC`, owner, owner)
+	if books == nil && err == nil {
+		books = make([]models.Book, 0)
+	}
+	return books, err
+}
+
+func (ss *SQLiteStorage) SetDeleteBookStatus(ctx context.Context, bid, deletedBy string, evts ...events.Event) error {
+	return ss.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `UPDATE books SET deleted_at = ?, deleted_by = ?
+			WHERE bid = ? AND deleted_at IS NULL`, time.Now().UTC(), deletedBy, bid)
+		if err != nil {
+			return err
+		}
+		if err = expectAffected(res); err != nil {
+			return err
+		}
+		return insertSQLiteEvents(ctx, tx, evts)
+	})
+}
+
+func (ss *SQLiteStorage) RestoreBook(ctx context.Context, bid string, evts ...events.Event) error {
+	return ss.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `UPDATE books SET deleted_at = NULL, deleted_by = NULL
+			WHERE bid = ? AND deleted_at IS NOT NULL`, bid)
+		if err != nil {
+			return err
+		}
+		if err = expectAffected(res); err != nil {
+			return err
+		}
+		return insertSQLiteEvents(ctx, tx, evts)
+	})
+}
+
+func (ss *SQLiteStorage) DeleteBooks(ctx context.Context, before time.Time, evts ...events.Event) (int, error) {
+	log := logger.Get()
+	var purged int
+	err := ss.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM books
+			WHERE deleted_at IS NOT NULL AND julianday(deleted_at) < julianday(?)`, before.UTC())
+		if err != nil {
+			log.Error().Err(err).Msg("delete books failed")
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		purged = int(affected)
+		if purged == 0 {
+			return nil
+		}
+		return insertSQLiteEvents(ctx, tx, evts)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+func (ss *SQLiteStorage) FetchPending(ctx context.Context, limit int) ([]events.Pending, error) {
+	log := logger.Get()
+	rows, err := ss.db.QueryContext(ctx, `SELECT id, type, payload, occurred_at, attempts, delivered FROM outbox
+		WHERE dispatched_at IS NULL AND dead_at IS NULL
+		AND (retry_at IS NULL OR julianday(retry_at) <= julianday(?))
+		ORDER BY julianday(occurred_at) LIMIT ?`, time.Now().UTC(), limit)
+	if err != nil {
+		log.Error().Err(err).Msg("failed get data from table outbox")
+		return nil, err
+	}
+	defer rows.Close()
+	var evts []events.Pending
+	for rows.Next() {
+		var evt events.Pending
+		var payload, delivered string
+		if err = rows.Scan(&evt.ID, &evt.Type, &payload, &evt.OccurredAt, &evt.Attempts, &delivered); err != nil {
+			log.Error().Err(err).Msg("failed scan rows data")
+			return nil, err
+		}
+		evt.Payload = []byte(payload)
+		if err = json.Unmarshal([]byte(delivered), &evt.Delivered); err != nil {
+			return nil, fmt.Errorf("outbox %s delivered: %w", evt.ID, err)
+		}
+		evts = append(evts, evt)
+	}
+	return evts, rows.Err()
+}
+
+func (ss *SQLiteStorage) MarkDispatched(ctx context.Context, id string) error {
+	_, err := ss.db.ExecContext(ctx, "UPDATE outbox SET dispatched_at = ? WHERE id = ?", time.Now().UTC(), id)
+	return err
+}
+
+func (ss *SQLiteStorage) MarkFailed(ctx context.Context, id string, f events.Failure) error {
+	delivered, err := json.Marshal(f.Delivered)
+	if err != nil {
+		return err
+	}
+	var retryAt, deadAt *time.Time
+	if f.Dead {
+		now := time.Now().UTC()
+		deadAt = &now
+	} else {
+		at := f.RetryAt.UTC()
+		retryAt = &at
+	}
+	_, err = ss.db.ExecContext(ctx, `UPDATE outbox SET attempts = ?, delivered = ?, last_error = ?, retry_at = ?, dead_at = ?
+		WHERE id = ?`, f.Attempts, string(delivered), f.Error, retryAt, deadAt, id)
+	return err
+}
+
+func (ss *SQLiteStorage) DeleteDispatched(ctx context.Context, retention time.Duration) (int, error) {
+	res, err := ss.db.ExecContext(ctx, `DELETE FROM outbox
+		WHERE dispatched_at IS NOT NULL AND julianday(dispatched_at) < julianday(?)`,
+		time.Now().UTC().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := res.RowsAffected()
+	return int(deleted), err
+}
+
+func (ss *SQLiteStorage) queryBook(ctx context.Context, query string, args ...any) (models.Book, error) {
+	book, err := scanSQLiteBook(ss.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Book{}, storageerror.ErrBookNoFound
+		}
+		return models.Book{}, err
+	}
+	return book, nil
+}
+
+func (ss *SQLiteStorage) queryBooks(ctx context.Context, query string, args ...any) ([]models.Book, error) {
+	log := logger.Get()
+	rows, err := ss.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("failed get data from table books")
+		return nil, err
+	}
+	defer rows.Close()
+	var books []models.Book
+	for rows.Next() {
+		book, err := scanSQLiteBook(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("failed scan rows data")
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+func (ss *SQLiteStorage) inTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	log := logger.Get()
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed start transaction: %w", err)
+	}
+	defer func() {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Error().Err(err).Msg("failed rollback transaction")
+		}
+	}()
+	if err = fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertSQLiteEvents(ctx context.Context, tx *sql.Tx, evts []events.Event) error {
+	for _, evt := range evts {
+		_, err := tx.ExecContext(ctx, "INSERT INTO outbox (id, type, payload, occurred_at) VALUES (?, ?, ?, ?)",
+			evt.ID.String(), string(evt.Type), string(evt.Payload), evt.OccurredAt.UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSQLiteBook(row rowScanner) (models.Book, error) {
+	var book models.Book
+	err := row.Scan(&book.BID, &book.Lable, &book.Author, &book.Description, &book.WritedAt, &book.Owner,
+		&book.DeletedAt, &book.DeletedBy)
+	return book, err
+}
+
+func expectAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storageerror.ErrBookNoFound
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var sqlErr *sqlite.Error
+	if !errors.As(err, &sqlErr) {
+		return false
+	}
+	code := sqlErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+func isForeignKeyViolation(err error) bool {
+	var sqlErr *sqlite.Error
+	return errors.As(err, &sqlErr) && sqlErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+}
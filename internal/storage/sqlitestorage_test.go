@@ -0,0 +1,306 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/events"
+	"github.com/Dorrrke/gt4-bookly/internal/storage"
+	"github.com/Dorrrke/gt4-bookly/internal/storage/storageerror"
+	"github.com/Dorrrke/gt4-bookly/internal/storage/storagetest"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/google/uuid"
+)
+
+func newSQLite(t *testing.T) *storage.SQLiteStorage {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bookly.db")
+	if err := storage.Migrations(storage.SQLiteDSN(path), "../../migrations/sqlite"); err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	stor, err := storage.NewSQLite(context.Background(), path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { stor.Close() })
+	return stor
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Backend {
+		return newSQLite(t)
+	})
+}
+
+func TestSQLiteOutboxRetry(t *testing.T) {
+	ctx := context.Background()
+	stor := newSQLite(t)
+	first, _ := events.NewBookRestored("first")
+	second, _ := events.NewBookRestored("second")
+	book := models.Book{Lable: "Dune", Author: "Frank Herbert", Description: "Spice", WritedAt: time.Now()}
+	if _, err := stor.SaveBook(ctx, book, first, second); err != nil {
+		t.Fatalf("save book: %v", err)
+	}
+	pendingIDs := func() []string {
+		t.Helper()
+		evts, err := stor.FetchPending(ctx, 10)
+		if err != nil {
+			t.Fatalf("fetch pending: %v", err)
+		}
+		var ids []string
+		for _, evt := range evts {
+			ids = append(ids, evt.ID.String())
+		}
+		return ids
+	}
+
+	err := stor.MarkFailed(ctx, first.ID.String(), events.Failure{
+		Attempts: 1, Delivered: []string{"webhooks"}, Error: "down", RetryAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("mark failed: %v", err)
+	}
+	if ids := pendingIDs(); !slices.Equal(ids, []string{second.ID.String()}) {
+		t.Fatalf("pending %v, want the event that is not waiting for a retry", ids)
+	}
+	if err = stor.MarkFailed(ctx, second.ID.String(), events.Failure{Attempts: 10, Error: "poison", Dead: true}); err != nil {
+		t.Fatalf("mark dead: %v", err)
+	}
+	if ids := pendingIDs(); len(ids) != 0 {
+		t.Fatalf("pending %v, want none", ids)
+	}
+
+	err = stor.MarkFailed(ctx, first.ID.String(), events.Failure{
+		Attempts: 2, Delivered: []string{"webhooks"}, Error: "down", RetryAt: time.Now().Add(-time.Second),
+	})
+	if err != nil {
+		t.Fatalf("mark failed: %v", err)
+	}
+	evts, err := stor.FetchPending(ctx, 10)
+	if err != nil || len(evts) != 1 {
+		t.Fatalf("fetch pending: %v (%v)", evts, err)
+	}
+	if evts[0].Attempts != 2 || !slices.Equal(evts[0].Delivered, []string{"webhooks"}) {
+		t.Fatalf("retried event %+v", evts[0])
+	}
+}
+
+func TestSQLiteOutboxCleanup(t *testing.T) {
+	ctx := context.Background()
+	stor := newSQLite(t)
+	old, _ := events.NewBookRestored("old")
+	recent, _ := events.NewBookRestored("recent")
+	dead, _ := events.NewBookRestored("dead")
+	book := models.Book{Lable: "Dune", Author: "Frank Herbert", Description: "Spice", WritedAt: time.Now()}
+	if _, err := stor.SaveBook(ctx, book, old, recent, dead); err != nil {
+		t.Fatalf("save book: %v", err)
+	}
+	for _, evt := range []events.Event{old, recent} {
+		if err := stor.MarkDispatched(ctx, evt.ID.String()); err != nil {
+			t.Fatalf("mark dispatched: %v", err)
+		}
+	}
+	if err := stor.MarkFailed(ctx, dead.ID.String(), events.Failure{Attempts: 10, Dead: true}); err != nil {
+		t.Fatalf("mark dead: %v", err)
+	}
+	_, err := stor.DB().ExecContext(ctx, "UPDATE outbox SET dispatched_at = ? WHERE id = ?",
+		time.Now().UTC().Add(-48*time.Hour), old.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := stor.DeleteDispatched(ctx, 24*time.Hour)
+	if err != nil || deleted != 1 {
+		t.Fatalf("deleted %d (%v), want the event dispatched two days ago", deleted, err)
+	}
+	var left []string
+	rows, err := stor.DB().QueryContext(ctx, "SELECT id FROM outbox ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		left = append(left, id)
+	}
+	want := []string{recent.ID.String(), dead.ID.String()}
+	slices.Sort(want)
+	if !slices.Equal(left, want) {
+		t.Fatalf("outbox keeps %v, want the recent and the dead event", left)
+	}
+}
+
+func TestSQLiteWebhooks(t *testing.T) {
+	ctx := context.Background()
+	stor := newSQLite(t)
+	id, err := stor.SaveWebhook(ctx, models.Webhook{
+		URL: "http://example.com", Secret: "s", Events: []string{"book.created"},
+	})
+	if err != nil {
+		t.Fatalf("save webhook: %v", err)
+	}
+	hook, err := stor.GetWebhook(ctx, id)
+	if err != nil || !slices.Equal(hook.Events, []string{"book.created"}) {
+		t.Fatalf("get webhook: %+v (%v)", hook, err)
+	}
+	_, err = stor.SaveDelivery(ctx, models.WebhookDelivery{WebhookID: uuid.New(), Event: "x", Payload: []byte(`{}`)})
+	if !errors.Is(err, storageerror.ErrWebhookNotFound) {
+		t.Fatalf("delivery for a missing webhook: %v, want ErrWebhookNotFound", err)
+	}
+
+	var ids []string
+	for range 2 {
+		dlvID, err := stor.SaveDelivery(ctx, models.WebhookDelivery{
+			WebhookID: hook.ID, Event: "book.created", Payload: []byte(`{"id":1}`), Status: "pending",
+		})
+		if err != nil {
+			t.Fatalf("save delivery: %v", err)
+		}
+		ids = append(ids, dlvID)
+	}
+	now := time.Now()
+	err = stor.UpdateDelivery(ctx, models.WebhookDelivery{
+		ID: uuid.MustParse(ids[0]), Status: "succeeded", Attempts: 1, ResponseCode: 200, DeliveredAt: &now,
+	})
+	if err != nil {
+		t.Fatalf("update delivery: %v", err)
+	}
+	pending, err := stor.GetPendingDeliveries(ctx)
+	if err != nil || len(pending) != 1 || pending[0].ID.String() != ids[1] {
+		t.Fatalf("pending %+v (%v), want the second delivery", pending, err)
+	}
+	if string(pending[0].Payload) != `{"id":1}` {
+		t.Fatalf("payload %s", pending[0].Payload)
+	}
+
+	// A claimed delivery is neither pending for a sweep nor claimable again,
+	// finishing it releases the claim.
+	claimed, ok, err := stor.ClaimDelivery(ctx, ids[1], time.Minute)
+	if err != nil || !ok || string(claimed.Payload) != `{"id":1}` {
+		t.Fatalf("claim: %+v %v (%v)", claimed, ok, err)
+	}
+	if _, ok, err = stor.ClaimDelivery(ctx, ids[1], time.Minute); err != nil || ok {
+		t.Fatalf("second claim: %v (%v), want false", ok, err)
+	}
+	if pending, err = stor.GetPendingDeliveries(ctx); err != nil || len(pending) != 0 {
+		t.Fatalf("pending while claimed %+v (%v), want none", pending, err)
+	}
+	if _, ok, err = stor.ClaimDelivery(ctx, ids[0], time.Minute); err != nil || ok {
+		t.Fatalf("claim of a sent delivery: %v (%v), want false", ok, err)
+	}
+	claimed.Status = "pending"
+	claimed.Attempts = 1
+	if err = stor.UpdateDelivery(ctx, claimed); err != nil {
+		t.Fatalf("update claimed delivery: %v", err)
+	}
+	if _, ok, _ = stor.ClaimDelivery(ctx, ids[1], time.Minute); ok {
+		t.Fatal("a failed attempt released the claim")
+	}
+	claimed.Status = "failed"
+	if err = stor.UpdateDelivery(ctx, claimed); err != nil {
+		t.Fatalf("update claimed delivery: %v", err)
+	}
+	claimed.Status = "pending"
+	if err = stor.UpdateDelivery(ctx, claimed); err != nil {
+		t.Fatalf("replay delivery: %v", err)
+	}
+	if _, ok, err = stor.ClaimDelivery(ctx, ids[1], time.Minute); err != nil || !ok {
+		t.Fatalf("claim after replay: %v (%v), want true", ok, err)
+	}
+	dlv, err := stor.GetDelivery(ctx, ids[0])
+	if err != nil || dlv.DeliveredAt == nil || dlv.ResponseCode != 200 {
+		t.Fatalf("delivered %+v (%v)", dlv, err)
+	}
+
+	if err = stor.DeleteWebhook(ctx, id); err != nil {
+		t.Fatalf("delete webhook: %v", err)
+	}
+	if _, err = stor.GetDelivery(ctx, ids[1]); !errors.Is(err, storageerror.ErrDeliveryNotFound) {
+		t.Fatalf("delivery of a deleted webhook: %v, want ErrDeliveryNotFound", err)
+	}
+}
+
+func TestSQLiteAuditLog(t *testing.T) {
+	ctx := context.Background()
+	stor := newSQLite(t)
+	start := time.Now().Add(-time.Hour)
+	for i, action := range []string{"book.create", "book.delete", "book.create"} {
+		err := stor.SaveAuditEntry(ctx, models.AuditEntry{
+			At: start.Add(time.Duration(i) * time.Minute), ActorUID: "u1", Action: action, Entity: "book",
+			After: []byte(`{"n":1}`),
+		})
+		if err != nil {
+			t.Fatalf("save audit entry: %v", err)
+		}
+	}
+	entries, total, err := stor.GetAuditEntries(ctx, models.AuditFilter{Action: "book.create", Limit: 1})
+	if err != nil || total != 2 || len(entries) != 1 {
+		t.Fatalf("entries %+v, total %d (%v)", entries, total, err)
+	}
+	if !entries[0].At.After(start) || string(entries[0].After) != `{"n":1}` || entries[0].Before != nil {
+		t.Fatalf("newest entry %+v", entries[0])
+	}
+	entries, total, err = stor.GetAuditEntries(ctx, models.AuditFilter{From: start.Add(30 * time.Second), Limit: 10})
+	if err != nil || total != 2 || len(entries) != 2 {
+		t.Fatalf("from filter: %d entries, total %d (%v)", len(entries), total, err)
+	}
+	// The relay may hand an audit event over twice, it is stored once.
+	redelivered := models.AuditEntry{ID: uuid.New(), At: time.Now(), Action: "book.restore", Entity: "book"}
+	for range 2 {
+		if err = stor.SaveAuditEntry(ctx, redelivered); err != nil {
+			t.Fatalf("save audit entry: %v", err)
+		}
+	}
+	if _, total, err = stor.GetAuditEntries(ctx, models.AuditFilter{Action: "book.restore"}); err != nil || total != 1 {
+		t.Fatalf("redelivered entry stored %d times (%v), want once", total, err)
+	}
+	if _, err = stor.DB().ExecContext(ctx, "DELETE FROM audit_log"); err == nil {
+		t.Fatal("audit log rows can be deleted")
+	}
+}
+
+func TestSQLiteJobState(t *testing.T) {
+	ctx := context.Background()
+	stor := newSQLite(t)
+	first := time.Now()
+	if err := stor.RequestRun(ctx, "purge", first); err != nil {
+		t.Fatalf("request run: %v", err)
+	}
+	if err := stor.RequestRun(ctx, "purge", first.Add(time.Minute)); err != nil {
+		t.Fatalf("request run: %v", err)
+	}
+	next := first.Add(time.Hour)
+	if err := stor.SaveJobState(ctx, models.JobState{Name: "purge", RunsTotal: 3, NextRunAt: &next}); err != nil {
+		t.Fatalf("save job state: %v", err)
+	}
+	state, err := stor.GetJobState(ctx, "purge")
+	if err != nil {
+		t.Fatalf("get job state: %v", err)
+	}
+	if state.RunsTotal != 3 || state.NextRunAt == nil || !state.NextRunAt.Equal(next) {
+		t.Fatalf("state %+v", state)
+	}
+	if state.TriggerRequestedAt == nil || !state.TriggerRequestedAt.Equal(first) {
+		t.Fatalf("trigger requested at %v, want the first request %v", state.TriggerRequestedAt, first)
+	}
+	if err = stor.ClearRunRequest(ctx, "purge", first.Add(-time.Second)); err != nil {
+		t.Fatalf("clear run request: %v", err)
+	}
+	if state, _ = stor.GetJobState(ctx, "purge"); state.TriggerRequestedAt == nil {
+		t.Fatal("a request newer than the run was cleared")
+	}
+	if err = stor.ClearRunRequest(ctx, "purge", first); err != nil {
+		t.Fatalf("clear run request: %v", err)
+	}
+	if state, _ = stor.GetJobState(ctx, "purge"); state.TriggerRequestedAt != nil {
+		t.Fatalf("trigger requested at %v after the run", state.TriggerRequestedAt)
+	}
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/logger"
+	"github.com/Dorrrke/gt4-bookly/internal/storage/storageerror"
+	"github.com/google/uuid"
+)
+
+const sqliteDeliveryColumns = `id, webhook_id, event, payload, status, attempts,
+	COALESCE(response_code, 0), COALESCE(last_error, ''), created_at, delivered_at`
+
+func (ss *SQLiteStorage) SaveWebhook(ctx context.Context, hook models.Webhook) (string, error) {
+	hook.ID = uuid.New()
+	evts, err := json.Marshal(hook.Events)
+	if err != nil {
+		return ``, err
+	}
+	_, err = ss.db.ExecContext(ctx, "INSERT INTO webhooks (id, url, secret, events, created_at) VALUES (?, ?, ?, ?, ?)",
+		hook.ID.String(), hook.URL, hook.Secret, string(evts), time.Now().UTC())
+	if err != nil {
+		return ``, err
+	}
+	return hook.ID.String(), nil
+}
+
+func (ss *SQLiteStorage) GetWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	log := logger.Get()
+	rows, err := ss.db.QueryContext(ctx, "SELECT id, url, secret, events, created_at FROM webhooks")
+	if err != nil {
+		log.Error().Err(err).Msg("failed get data from table webhooks")
+		return nil, err
+	}
+	defer rows.Close()
+	var hooks []models.Webhook
+	for rows.Next() {
+		hook, err := scanSQLiteWebhook(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("failed scan rows data")
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+func (ss *SQLiteStorage) GetWebhook(ctx context.Context, id string) (models.Webhook, error) {
+	row := ss.db.QueryRowContext(ctx, "SELECT id, url, secret, events, created_at FROM webhooks WHERE id = ?", id)
+	hook, err := scanSQLiteWebhook(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Webhook{}, storageerror.ErrWebhookNotFound
+		}
+		return models.Webhook{}, err
+	}
+	return hook, nil
+}
+
+func (ss *SQLiteStorage) DeleteWebhook(ctx context.Context, id string) error {
+	res, err := ss.db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storageerror.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (ss *SQLiteStorage) SaveDelivery(ctx context.Context, dlv models.WebhookDelivery) (string, error) {
+	dlv.ID = uuid.New()
+	_, err := ss.db.ExecContext(ctx, `INSERT INTO webhook_deliveries
+		(id, webhook_id, event, payload, status, attempts, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		dlv.ID.String(), dlv.WebhookID.String(), dlv.Event, string(dlv.Payload), dlv.Status, dlv.Attempts,
+		time.Now().UTC())
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return ``, storageerror.ErrWebhookNotFound
+		}
+		return ``, err
+	}
+	return dlv.ID.String(), nil
+}
+
+func (ss *SQLiteStorage) UpdateDelivery(ctx context.Context, dlv models.WebhookDelivery) error {
+	var deliveredAt *time.Time
+	if dlv.DeliveredAt != nil {
+		at := dlv.DeliveredAt.UTC()
+		deliveredAt = &at
+	}
+	// Finishing a delivery releases the claim, so a replay can claim it at once.
+	res, err := ss.db.ExecContext(ctx, `UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, response_code = ?, last_error = ?, delivered_at = ?,
+			claimed_until = CASE WHEN ? = ? THEN claimed_until END
+		WHERE id = ?`,
+		dlv.Status, dlv.Attempts, dlv.ResponseCode, dlv.LastError, deliveredAt, dlv.Status, deliveryPending,
+		dlv.ID.String())
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storageerror.ErrDeliveryNotFound
+	}
+	return nil
+}
+
+func (ss *SQLiteStorage) GetDelivery(ctx context.Context, id string) (models.WebhookDelivery, error) {
+	row := ss.db.QueryRowContext(ctx, "SELECT "+sqliteDeliveryColumns+" FROM webhook_deliveries WHERE id = ?", id)
+	dlv, err := scanSQLiteDelivery(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.WebhookDelivery{}, storageerror.ErrDeliveryNotFound
+		}
+		return models.WebhookDelivery{}, err
+	}
+	return dlv, nil
+}
+
+func (ss *SQLiteStorage) GetDeliveries(ctx context.Context, webhookID string) ([]models.WebhookDelivery, error) {
+	return ss.queryDeliveries(ctx, "SELECT "+sqliteDeliveryColumns+` FROM webhook_deliveries
+		WHERE webhook_id = ? ORDER BY julianday(created_at) DESC`, webhookID)
+}
+
+func (ss *SQLiteStorage) GetPendingDeliveries(ctx context.Context) ([]models.WebhookDelivery, error) {
+	return ss.queryDeliveries(ctx, "SELECT "+sqliteDeliveryColumns+` FROM webhook_deliveries
+		WHERE status = ? AND (claimed_until IS NULL OR julianday(claimed_until) < julianday(?))
+		ORDER BY julianday(created_at)`, deliveryPending, time.Now().UTC())
+}
+
+func (ss *SQLiteStorage) ClaimDelivery(
+	ctx context.Context, id string, lease time.Duration,
+) (models.WebhookDelivery, bool, error) {
+	now := time.Now().UTC()
+	row := ss.db.QueryRowContext(ctx, `UPDATE webhook_deliveries SET claimed_until = ?
+		WHERE id = ? AND status = ? AND (claimed_until IS NULL OR julianday(claimed_until) < julianday(?))
+		RETURNING `+sqliteDeliveryColumns, now.Add(lease), id, deliveryPending, now)
+	dlv, err := scanSQLiteDelivery(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		dlv, err = ss.GetDelivery(ctx, id)
+		return dlv, false, err
+	}
+	if err != nil {
+		return models.WebhookDelivery{}, false, err
+	}
+	return dlv, true, nil
+}
+
+func (ss *SQLiteStorage) queryDeliveries(
+	ctx context.Context, query string, args ...any,
+) ([]models.WebhookDelivery, error) {
+	log := logger.Get()
+	rows, err := ss.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("failed get data from table webhook_deliveries")
+		return nil, err
+	}
+	defer rows.Close()
+	var dlvs []models.WebhookDelivery
+	for rows.Next() {
+		dlv, err := scanSQLiteDelivery(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("failed scan rows data")
+			return nil, err
+		}
+		dlvs = append(dlvs, dlv)
+	}
+	return dlvs, rows.Err()
+}
+
+func scanSQLiteWebhook(row rowScanner) (models.Webhook, error) {
+	var hook models.Webhook
+	var evts string
+	if err := row.Scan(&hook.ID, &hook.URL, &hook.Secret, &evts, &hook.CreatedAt); err != nil {
+		return models.Webhook{}, err
+	}
+	if err := json.Unmarshal([]byte(evts), &hook.Events); err != nil {
+		return models.Webhook{}, fmt.Errorf("webhook %s events: %w", hook.ID, err)
+	}
+	return hook, nil
+}
+
+func scanSQLiteDelivery(row rowScanner) (models.WebhookDelivery, error) {
+	var dlv models.WebhookDelivery
+	var payload string
+	err := row.Scan(&dlv.ID, &dlv.WebhookID, &dlv.Event, &payload, &dlv.Status, &dlv.Attempts,
+		&dlv.ResponseCode, &dlv.LastError, &dlv.CreatedAt, &dlv.DeliveredAt)
+	dlv.Payload = []byte(payload)
+	return dlv, err
+}
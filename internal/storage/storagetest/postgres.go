@@ -0,0 +1,84 @@
+package storagetest
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	// DSNEnv points the suite at an already running Postgres.
+	DSNEnv = "BOOKLY_TEST_DSN"
+	// PGBinEnv is the directory with initdb and pg_ctl, PATH is used otherwise.
+	PGBinEnv = "BOOKLY_TEST_PG_BIN"
+)
+
+// PostgresDSN returns a DSN from DSNEnv or starts a throwaway cluster with the
+// local Postgres binaries. The test is skipped when neither is available.
+func PostgresDSN(t *testing.T) string {
+	t.Helper()
+	if dsn := os.Getenv(DSNEnv); dsn != "" {
+		return dsn
+	}
+	initdb, pgctl, ok := lookupPG()
+	if !ok {
+		t.Skipf("postgres binaries not found, set %s or %s", DSNEnv, PGBinEnv)
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("initdb refuses to run as root, set " + DSNEnv)
+	}
+
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	run(t, initdb, "-D", data, "-U", "bookly", "--auth=trust", "-E", "UTF8")
+	port := freePort(t)
+	run(t, pgctl, "-D", data, "-l", filepath.Join(dir, "postgres.log"), "-w", "start",
+		"-o", fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -c fsync=off", port, dir))
+	t.Cleanup(func() {
+		out, err := exec.Command(pgctl, "-D", data, "-m", "immediate", "stop").CombinedOutput()
+		if err != nil {
+			t.Logf("pg_ctl stop: %v\n%s", err, out)
+		}
+	})
+	return fmt.Sprintf("postgres://bookly@127.0.0.1:%d/postgres?sslmode=disable", port)
+}
+
+func lookupPG() (string, string, bool) {
+	if dir := os.Getenv(PGBinEnv); dir != "" {
+		return filepath.Join(dir, "initdb"), filepath.Join(dir, "pg_ctl"), true
+	}
+	initdb, err := exec.LookPath("initdb")
+	if err != nil {
+		return "", "", false
+	}
+	pgctl, err := exec.LookPath("pg_ctl")
+	if err != nil {
+		return "", "", false
+	}
+	return initdb, pgctl, true
+}
+
+func run(t *testing.T, name string, args ...string) {
+	t.Helper()
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", filepath.Base(name), err, out)
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("reserve port: %v", err)
+	}
+	defer l.Close()
+	addr, ok := l.Addr().(*net.TCPAddr)
+	if !ok {
+		t.Fatalf("unexpected listener address %v", l.Addr())
+	}
+	return addr.Port
+}
@@ -0,0 +1,426 @@
+// Package storagetest contains the contract every user and book storage
+// backend has to satisfy. Backends run it from their own tests via Run.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Dorrrke/gt4-bookly/internal/domain/models"
+	"github.com/Dorrrke/gt4-bookly/internal/service"
+	"github.com/Dorrrke/gt4-bookly/internal/storage/storageerror"
+	"github.com/google/uuid"
+)
+
+const workers = 16
+
+type Backend interface {
+	service.Storage
+	service.BookStorage
+}
+
+// Factory must return an empty backend on every call.
+type Factory func(t *testing.T) Backend
+
+func Run(t *testing.T, newBackend Factory) {
+	t.Helper()
+	tests := []struct {
+		name string
+		fn   func(*testing.T, Backend)
+	}{
+		{"UserSaveValidate", testUserSaveValidate},
+		{"UserDuplicate", testUserDuplicate},
+		{"UserErrors", testUserErrors},
+		{"BookSaveGet", testBookSaveGet},
+		{"BookDuplicate", testBookDuplicate},
+		{"BookNotFound", testBookNotFound},
+		{"SoftDelete", testSoftDelete},
+		{"Restore", testRestore},
+		{"Purge", testPurge},
+		{"ConcurrentUsers", testConcurrentUsers},
+		{"ConcurrentBooks", testConcurrentBooks},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newBackend(t))
+		})
+	}
+}
+
+func testUserSaveValidate(t *testing.T, b Backend) {
+	ctx := context.Background()
+	user := newUser("reader@example.com")
+	uid, err := b.SaveUser(ctx, user)
+	if err != nil {
+		t.Fatalf("SaveUser: %v", err)
+	}
+	if uid != user.UID.String() {
+		t.Fatalf("SaveUser returned uid %s, want %s", uid, user.UID)
+	}
+	got, err := b.ValidateUser(ctx, models.UserLogin{Email: user.Email, Passoword: user.Passoword})
+	if err != nil {
+		t.Fatalf("ValidateUser: %v", err)
+	}
+	if got != uid {
+		t.Fatalf("ValidateUser returned uid %s, want %s", got, uid)
+	}
+
+	uid, err = b.SaveUser(ctx, models.User{Name: "anon", Email: "anon@example.com", Passoword: "secret"})
+	if err != nil {
+		t.Fatalf("SaveUser without uid: %v", err)
+	}
+	if _, err = uuid.Parse(uid); err != nil {
+		t.Fatalf("SaveUser generated invalid uid %q: %v", uid, err)
+	}
+}
+
+func testUserDuplicate(t *testing.T, b Backend) {
+	ctx := context.Background()
+	if _, err := b.SaveUser(ctx, newUser("dup@example.com")); err != nil {
+		t.Fatalf("SaveUser: %v", err)
+	}
+	_, err := b.SaveUser(ctx, newUser("dup@example.com"))
+	if !errors.Is(err, storageerror.ErrUserAlredyExist) {
+		t.Fatalf("SaveUser duplicate: got %v, want %v", err, storageerror.ErrUserAlredyExist)
+	}
+}
+
+func testUserErrors(t *testing.T, b Backend) {
+	ctx := context.Background()
+	user := newUser("known@example.com")
+	if _, err := b.SaveUser(ctx, user); err != nil {
+		t.Fatalf("SaveUser: %v", err)
+	}
+	_, err := b.ValidateUser(ctx, models.UserLogin{Email: "unknown@example.com", Passoword: user.Passoword})
+	if !errors.Is(err, storageerror.ErrUserNoExist) {
+		t.Fatalf("ValidateUser unknown email: got %v, want %v", err, storageerror.ErrUserNoExist)
+	}
+	_, err = b.ValidateUser(ctx, models.UserLogin{Email: user.Email, Passoword: "wrong"})
+	if !errors.Is(err, storageerror.ErrInvalidPassword) {
+		t.Fatalf("ValidateUser wrong password: got %v, want %v", err, storageerror.ErrInvalidPassword)
+	}
+}
+
+func testBookSaveGet(t *testing.T, b Backend) {
+	ctx := context.Background()
+	books, err := b.GetBooks(ctx)
+	if err != nil {
+		t.Fatalf("GetBooks on empty storage: %v", err)
+	}
+	if len(books) != 0 {
+		t.Fatalf("GetBooks on empty storage returned %d books", len(books))
+	}
+
+	book := newBook("Dune", "Herbert")
+	bid, err := b.SaveBook(ctx, book)
+	if err != nil {
+		t.Fatalf("SaveBook: %v", err)
+	}
+	if bid != book.BID.String() {
+		t.Fatalf("SaveBook returned bid %s, want %s", bid, book.BID)
+	}
+	got, err := b.GetBook(ctx, bid)
+	if err != nil {
+		t.Fatalf("GetBook: %v", err)
+	}
+	assertBook(t, got, book)
+
+	if _, err = b.SaveBook(ctx, newBook("Emma", "Austen")); err != nil {
+		t.Fatalf("SaveBook: %v", err)
+	}
+	books, err = b.GetBooks(ctx)
+	if err != nil {
+		t.Fatalf("GetBooks: %v", err)
+	}
+	if len(books) != 2 {
+		t.Fatalf("GetBooks returned %d books, want 2", len(books))
+	}
+}
+
+func testBookDuplicate(t *testing.T, b Backend) {
+	ctx := context.Background()
+	if _, err := b.SaveBook(ctx, newBook("Dune", "Herbert")); err != nil {
+		t.Fatalf("SaveBook: %v", err)
+	}
+	_, err := b.SaveBook(ctx, newBook("Dune", "Herbert"))
+	if !errors.Is(err, storageerror.ErrBookAlredyExist) {
+		t.Fatalf("SaveBook duplicate: got %v, want %v", err, storageerror.ErrBookAlredyExist)
+	}
+	if _, err = b.SaveBook(ctx, newBook("Dune", "Villeneuve")); err != nil {
+		t.Fatalf("SaveBook same title, other author: %v", err)
+	}
+}
+
+func testBookNotFound(t *testing.T, b Backend) {
+	ctx := context.Background()
+	missing := uuid.NewString()
+	if _, err := b.GetBook(ctx, missing); !errors.Is(err, storageerror.ErrBookNoFound) {
+		t.Fatalf("GetBook: got %v, want %v", err, storageerror.ErrBookNoFound)
+	}
+	if _, err := b.GetDeletedBook(ctx, missing); !errors.Is(err, storageerror.ErrBookNoFound) {
+		t.Fatalf("GetDeletedBook: got %v, want %v", err, storageerror.ErrBookNoFound)
+	}
+	if err := b.SetDeleteBookStatus(ctx, missing, "admin"); !errors.Is(err, storageerror.ErrBookNoFound) {
+		t.Fatalf("SetDeleteBookStatus: got %v, want %v", err, storageerror.ErrBookNoFound)
+	}
+	if err := b.RestoreBook(ctx, missing); !errors.Is(err, storageerror.ErrBookNoFound) {
+		t.Fatalf("RestoreBook: got %v, want %v", err, storageerror.ErrBookNoFound)
+	}
+}
+
+func testSoftDelete(t *testing.T, b Backend) {
+	ctx := context.Background()
+	book := newBook("Dune", "Herbert")
+	book.Owner = "owner-1"
+	bid := saveBook(t, b, book)
+	other := newBook("Emma", "Austen")
+	other.Owner = "owner-2"
+	otherID := saveBook(t, b, other)
+
+	if err := b.SetDeleteBookStatus(ctx, bid, "owner-1"); err != nil {
+		t.Fatalf("SetDeleteBookStatus: %v", err)
+	}
+	if err := b.SetDeleteBookStatus(ctx, otherID, "owner-2"); err != nil {
+		t.Fatalf("SetDeleteBookStatus: %v", err)
+	}
+	if _, err := b.GetBook(ctx, bid); !errors.Is(err, storageerror.ErrBookNoFound) {
+		t.Fatalf("GetBook after delete: got %v, want %v", err, storageerror.ErrBookNoFound)
+	}
+	books, err := b.GetBooks(ctx)
+	if err != nil {
+		t.Fatalf("GetBooks: %v", err)
+	}
+	if len(books) != 0 {
+		t.Fatalf("GetBooks returned %d deleted books", len(books))
+	}
+	if err = b.SetDeleteBookStatus(ctx, bid, "owner-1"); !errors.Is(err, storageerror.ErrBookNoFound) {
+		t.Fatalf("SetDeleteBookStatus twice: got %v, want %v", err, storageerror.ErrBookNoFound)
+	}
+
+	got, err := b.GetDeletedBook(ctx, bid)
+	if err != nil {
+		t.Fatalf("GetDeletedBook: %v", err)
+	}
+	assertBook(t, got, book)
+	if got.DeletedAt == nil || got.DeletedBy != "owner-1" {
+		t.Fatalf("GetDeletedBook: deleted_at=%v deleted_by=%q", got.DeletedAt, got.DeletedBy)
+	}
+
+	trash, err := b.GetDeletedBooks(ctx, "")
+	if err != nil {
+		t.Fatalf("GetDeletedBooks: %v", err)
+	}
+	if len(trash) != 2 {
+		t.Fatalf("GetDeletedBooks returned %d books, want 2", len(trash))
+	}
+	trash, err = b.GetDeletedBooks(ctx, "owner-1")
+	if err != nil {
+		t.Fatalf("GetDeletedBooks by owner: %v", err)
+	}
+	if len(trash) != 1 || trash[0].BID != book.BID {
+		t.Fatalf("GetDeletedBooks by owner returned %v, want only %s", trash, book.BID)
+	}
+
+	if _, err = b.SaveBook(ctx, newBook("Dune", "Herbert")); !errors.Is(err, storageerror.ErrBookAlredyExist) {
+		t.Fatalf("SaveBook matching a deleted book: got %v, want %v", err, storageerror.ErrBookAlredyExist)
+	}
+}
+
+func testRestore(t *testing.T, b Backend) {
+	ctx := context.Background()
+	book := newBook("Dune", "Herbert")
+	bid := saveBook(t, b, book)
+	if err := b.RestoreBook(ctx, bid); !errors.Is(err, storageerror.ErrBookNoFound) {
+		t.Fatalf("RestoreBook on live book: got %v, want %v", err, storageerror.ErrBookNoFound)
+	}
+	if err := b.SetDeleteBookStatus(ctx, bid, "admin"); err != nil {
+		t.Fatalf("SetDeleteBookStatus: %v", err)
+	}
+	if err := b.RestoreBook(ctx, bid); err != nil {
+		t.Fatalf("RestoreBook: %v", err)
+	}
+	got, err := b.GetBook(ctx, bid)
+	if err != nil {
+		t.Fatalf("GetBook after restore: %v", err)
+	}
+	assertBook(t, got, book)
+	if _, err = b.GetDeletedBook(ctx, bid); !errors.Is(err, storageerror.ErrBookNoFound) {
+		t.Fatalf("GetDeletedBook after restore: got %v, want %v", err, storageerror.ErrBookNoFound)
+	}
+}
+
+func testPurge(t *testing.T, b Backend) {
+	ctx := context.Background()
+	live := saveBook(t, b, newBook("Emma", "Austen"))
+	var deleted []string
+	var deletedAt []time.Time
+	for i := range 3 {
+		bid := saveBook(t, b, newBook(fmt.Sprintf("Volume %d", i), "Tolkien"))
+		if err := b.SetDeleteBookStatus(ctx, bid, "admin"); err != nil {
+			t.Fatalf("SetDeleteBookStatus: %v", err)
+		}
+		book, err := b.GetDeletedBook(ctx, bid)
+		if err != nil || book.DeletedAt == nil {
+			t.Fatalf("GetDeletedBook: %+v (%v)", book, err)
+		}
+		// A shifted time zone would move deleted_at by whole hours.
+		if off := time.Since(*book.DeletedAt); off < -time.Minute || off > time.Minute {
+			t.Fatalf("deleted_at %v is %v off the current time", book.DeletedAt, off)
+		}
+		deleted = append(deleted, bid)
+		deletedAt = append(deletedAt, *book.DeletedAt)
+		// SQLite compares times in whole milliseconds.
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	// A book is purged once it was deleted before the cutoff, not at it.
+	purged, err := b.DeleteBooks(ctx, deletedAt[0])
+	if err != nil {
+		t.Fatalf("DeleteBooks at the first deletion: %v", err)
+	}
+	if purged != 0 {
+		t.Fatalf("DeleteBooks at the first deletion purged %d books, want 0", purged)
+	}
+	purged, err = b.DeleteBooks(ctx, deletedAt[0].Add(time.Millisecond))
+	if err != nil {
+		t.Fatalf("DeleteBooks just after the first deletion: %v", err)
+	}
+	if purged != 1 {
+		t.Fatalf("DeleteBooks just after the first deletion purged %d books, want 1", purged)
+	}
+	purged, err = b.DeleteBooks(ctx, deletedAt[len(deletedAt)-1].Add(time.Millisecond))
+	if err != nil {
+		t.Fatalf("DeleteBooks: %v", err)
+	}
+	if purged != len(deleted)-1 {
+		t.Fatalf("DeleteBooks purged %d books, want %d", purged, len(deleted)-1)
+	}
+	for _, bid := range deleted {
+		if _, err = b.GetDeletedBook(ctx, bid); !errors.Is(err, storageerror.ErrBookNoFound) {
+			t.Fatalf("GetDeletedBook after purge: got %v, want %v", err, storageerror.ErrBookNoFound)
+		}
+	}
+	if _, err = b.GetBook(ctx, live); err != nil {
+		t.Fatalf("GetBook of live book after purge: %v", err)
+	}
+}
+
+func testConcurrentUsers(t *testing.T, b Backend) {
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := b.SaveUser(ctx, newUser("race@example.com"))
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	assertSingleWinner(t, errs, storageerror.ErrUserAlredyExist)
+}
+
+func testConcurrentBooks(t *testing.T, b Backend) {
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := b.SaveBook(ctx, newBook("Dune", "Herbert"))
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	assertSingleWinner(t, errs, storageerror.ErrBookAlredyExist)
+
+	bids := make(chan string, workers)
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bid, err := b.SaveBook(ctx, newBook(fmt.Sprintf("Book %d", i), "Various"))
+			if err != nil {
+				t.Errorf("SaveBook: %v", err)
+				return
+			}
+			if _, err = b.GetBooks(ctx); err != nil {
+				t.Errorf("GetBooks: %v", err)
+			}
+			if err = b.SetDeleteBookStatus(ctx, bid, "admin"); err != nil {
+				t.Errorf("SetDeleteBookStatus: %v", err)
+			}
+			bids <- bid
+		}()
+	}
+	wg.Wait()
+	close(bids)
+	trash, err := b.GetDeletedBooks(ctx, "")
+	if err != nil {
+		t.Fatalf("GetDeletedBooks: %v", err)
+	}
+	if len(trash) != len(bids) {
+		t.Fatalf("GetDeletedBooks returned %d books, want %d", len(trash), len(bids))
+	}
+}
+
+func assertSingleWinner(t *testing.T, errs <-chan error, sentinel error) {
+	t.Helper()
+	var ok int
+	for err := range errs {
+		switch {
+		case err == nil:
+			ok++
+		case !errors.Is(err, sentinel):
+			t.Fatalf("concurrent save: got %v, want nil or %v", err, sentinel)
+		}
+	}
+	if ok != 1 {
+		t.Fatalf("concurrent save succeeded %d times, want 1", ok)
+	}
+}
+
+func assertBook(t *testing.T, got, want models.Book) {
+	t.Helper()
+	if got.BID != want.BID || got.Lable != want.Lable || got.Author != want.Author ||
+		got.Description != want.Description || got.Owner != want.Owner || !got.WritedAt.Equal(want.WritedAt) {
+		t.Fatalf("book mismatch:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func saveBook(t *testing.T, b Backend, book models.Book) string {
+	t.Helper()
+	bid, err := b.SaveBook(context.Background(), book)
+	if err != nil {
+		t.Fatalf("SaveBook: %v", err)
+	}
+	return bid
+}
+
+func newUser(email string) models.User {
+	return models.User{
+		UID:       uuid.New(),
+		Name:      "Reader",
+		Email:     email,
+		Passoword: "secret",
+		Age:       30,
+	}
+}
+
+func newBook(lable, author string) models.Book {
+	return models.Book{
+		BID:         uuid.New(),
+		Lable:       lable,
+		Author:      author,
+		Description: "conformance",
+		WritedAt:    time.Date(1965, time.August, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
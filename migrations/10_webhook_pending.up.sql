@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries(created_at) WHERE status = 'pending';
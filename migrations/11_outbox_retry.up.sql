@@ -0,0 +1,8 @@
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS attempts integer NOT NULL DEFAULT 0;
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS delivered text[] NOT NULL DEFAULT '{}';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS last_error text NOT NULL DEFAULT '';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS retry_at timestamp;
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS dead_at timestamp;
+
+DROP INDEX IF EXISTS outbox_pending_idx;
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox(occurred_at) WHERE dispatched_at IS NULL AND dead_at IS NULL;
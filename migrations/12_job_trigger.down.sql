@@ -0,0 +1 @@
+ALTER TABLE job_state DROP COLUMN IF EXISTS trigger_requested_at;
@@ -0,0 +1 @@
+ALTER TABLE job_state ADD COLUMN IF NOT EXISTS trigger_requested_at timestamp;
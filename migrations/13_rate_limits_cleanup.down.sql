@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS login_failures_last_failure_at_idx;
+DROP INDEX IF EXISTS rate_limits_full_at_idx;
+
+ALTER TABLE rate_limits DROP COLUMN IF EXISTS full_at;
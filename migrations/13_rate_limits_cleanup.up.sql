@@ -0,0 +1,4 @@
+ALTER TABLE rate_limits ADD COLUMN IF NOT EXISTS full_at timestamptz NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS rate_limits_full_at_idx ON rate_limits(full_at);
+CREATE INDEX IF NOT EXISTS login_failures_last_failure_at_idx ON login_failures(last_failure_at);
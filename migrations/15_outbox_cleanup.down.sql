@@ -0,0 +1 @@
+DROP INDEX IF EXISTS outbox_dispatched_at_idx;
@@ -0,0 +1 @@
+ALTER TABLE books ALTER COLUMN deleted_at TYPE timestamp;
@@ -0,0 +1,3 @@
+-- deleted_at was always set with NOW(), so existing values are read in the
+-- session time zone they were written in.
+ALTER TABLE books ALTER COLUMN deleted_at TYPE timestamptz;
@@ -0,0 +1,5 @@
+ALTER TABLE job_state
+    ALTER COLUMN last_run_at TYPE timestamp,
+    ALTER COLUMN last_success_at TYPE timestamp,
+    ALTER COLUMN next_run_at TYPE timestamp,
+    ALTER COLUMN trigger_requested_at TYPE timestamp;
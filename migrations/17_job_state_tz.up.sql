@@ -0,0 +1,7 @@
+-- The times were written as the wall clock of the process that ran the job,
+-- they are read in the session time zone, which is the same on most setups.
+ALTER TABLE job_state
+    ALTER COLUMN last_run_at TYPE timestamptz,
+    ALTER COLUMN last_success_at TYPE timestamptz,
+    ALTER COLUMN next_run_at TYPE timestamptz,
+    ALTER COLUMN trigger_requested_at TYPE timestamptz;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS webhooks(
+    id varchar(36) NOT NULL PRIMARY KEY,
+    url text NOT NULL,
+    secret text NOT NULL,
+    events text[] NOT NULL,
+    created_at timestamp NOT NULL default NOW()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries(
+    id varchar(36) NOT NULL PRIMARY KEY,
+    webhook_id varchar(36) NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event text NOT NULL,
+    payload jsonb NOT NULL,
+    status text NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    response_code integer,
+    last_error text,
+    created_at timestamp NOT NULL default NOW(),
+    delivered_at timestamp
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_idx ON webhook_deliveries(webhook_id);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS outbox(
+    id varchar(36) NOT NULL PRIMARY KEY,
+    type text NOT NULL,
+    payload jsonb NOT NULL,
+    occurred_at timestamp NOT NULL,
+    dispatched_at timestamp
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox(occurred_at) WHERE dispatched_at IS NULL;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS audit_log(
+    id varchar(36) NOT NULL PRIMARY KEY,
+    at timestamp NOT NULL default NOW(),
+    actor_uid text NOT NULL DEFAULT '',
+    action text NOT NULL,
+    entity text NOT NULL,
+    entity_id text NOT NULL DEFAULT '',
+    before jsonb,
+    after jsonb,
+    request_id text NOT NULL DEFAULT '',
+    ip text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_at_idx ON audit_log(at);
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log(actor_uid);
+
+CREATE OR REPLACE RULE audit_log_no_update AS ON UPDATE TO audit_log DO INSTEAD NOTHING;
+CREATE OR REPLACE RULE audit_log_no_delete AS ON DELETE TO audit_log DO INSTEAD NOTHING;
@@ -0,0 +1,7 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS owner text NOT NULL DEFAULT '';
+ALTER TABLE books ADD COLUMN IF NOT EXISTS deleted_at timestamp;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS deleted_by text;
+
+UPDATE books SET deleted_at = NOW() WHERE deleted = true AND deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS books_deleted_at_idx ON books(deleted_at) WHERE deleted = true;
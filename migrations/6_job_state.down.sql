@@ -0,0 +1 @@
+DROP TABLE IF EXISTS job_state;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS job_state(
+    name text NOT NULL PRIMARY KEY,
+    last_run_at timestamp,
+    last_success_at timestamp,
+    last_error text NOT NULL DEFAULT '',
+    last_result integer NOT NULL DEFAULT 0,
+    last_duration_ms bigint NOT NULL DEFAULT 0,
+    next_run_at timestamp,
+    runs_total bigint NOT NULL DEFAULT 0,
+    failures_total bigint NOT NULL DEFAULT 0,
+    affected_total bigint NOT NULL DEFAULT 0
+);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS leases(
+    name text NOT NULL PRIMARY KEY,
+    holder text NOT NULL,
+    expires_at timestamp NOT NULL
+);
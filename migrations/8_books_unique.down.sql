@@ -0,0 +1 @@
+DROP INDEX IF EXISTS books_lable_author_idx;
@@ -0,0 +1 @@
+CREATE UNIQUE INDEX IF NOT EXISTS books_lable_author_idx ON books(lable, author);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS rate_limits(
+    key text NOT NULL PRIMARY KEY,
+    tokens double precision NOT NULL,
+    allowed boolean NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS login_failures(
+    key text NOT NULL PRIMARY KEY,
+    failures integer NOT NULL,
+    last_failure_at timestamptz NOT NULL,
+    locked_until timestamptz
+);
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS users(
+    uid TEXT NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    pass TEXT NOT NULL,
+    age INTEGER,
+    registered_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS books(
+    bid TEXT NOT NULL PRIMARY KEY,
+    lable TEXT NOT NULL,
+    author TEXT NOT NULL,
+    descriptons TEXT NOT NULL,
+    writed_at TIMESTAMP NOT NULL,
+    owner TEXT NOT NULL DEFAULT '',
+    deleted_at TIMESTAMP,
+    deleted_by TEXT,
+    UNIQUE (lable, author)
+);
+
+CREATE INDEX IF NOT EXISTS books_deleted_at_idx ON books(deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS outbox(
+    id TEXT NOT NULL PRIMARY KEY,
+    type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    occurred_at TIMESTAMP NOT NULL,
+    dispatched_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox(occurred_at) WHERE dispatched_at IS NULL;
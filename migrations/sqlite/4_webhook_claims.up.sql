@@ -0,0 +1 @@
+ALTER TABLE webhook_deliveries ADD COLUMN claimed_until TIMESTAMP;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS outbox_dispatched_at_idx ON outbox(dispatched_at) WHERE dispatched_at IS NOT NULL;